@@ -6,14 +6,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/amirimatin/gapBotApi/v2/i18n"
 	"github.com/go-resty/resty/v2"
 	"github.com/gofiber/fiber/v2"
-	"io"
+	"image"
 	"log"
 	"mime/multipart"
 	"net/url"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -25,8 +27,49 @@ type BotAPI struct {
 	Handlers       map[string][]Handler `json:"-"`
 	Middlewares    []Handler            `json:"-"`
 	DefaultHandler Handler              `json:"-"`
+	// MediaRules are checked before a file is uploaded, keyed by message type.
+	MediaRules map[MESSAGE_TYPE]MediaRule `json:"-"`
+	// CallbackCodec encodes the buttons built by BotAPI.NewInlineKeyboardButton and
+	// decodes the button presses received in updates. Defaults to JSONCallbackCodec.
+	CallbackCodec CallbackCodec `json:"-"`
+	// ImageOptions enables preprocessing of photos before upload when set.
+	ImageOptions *ImageOptions `json:"-"`
+	// StrictUpdates makes HandleUpdates fail on updates of an unknown type instead of
+	// routing them like a message without text. UnknownTypeHandler still receives
+	// them when set.
+	StrictUpdates bool `json:"-"`
+	// UnknownTypeHandler receives the updates of an unknown type when set, in place
+	// of the regular handlers, whether or not StrictUpdates is set.
+	UnknownTypeHandler Handler `json:"-"`
+	// CallbackErrorHandler receives the button presses whose data fails to decode
+	// with ErrCallbackSignature or ErrCallbackExpired, in place of the regular
+	// handlers, e.g. to tell the user the menu is stale. DefaultHandler receives them
+	// when it is not set. The press is answered either way.
+	CallbackErrorHandler Handler `json:"-"`
+	// Ledger records pay callbacks before they are routed when set. Duplicate
+	// callbacks are dropped without reaching any handler.
+	Ledger *Ledger `json:"-"`
+	// Subscribers records the chat of every update of a known type before it is
+	// routed when set.
+	Subscribers *Subscribers `json:"-"`
+	// Scheduler delivers requests at a later time or on a cron schedule. NewScheduler
+	// sets it.
+	Scheduler *Scheduler `json:"-"`
+	// I18n translates the messages of Ctx.T and Ctx.N when set.
+	I18n *i18n.Bundle `json:"-"`
+	// TextNormalizer rewrites the text of incoming messages before they are routed
+	// when set, e.g. persian.Normalize.
+	TextNormalizer func(string) string `json:"-"`
 	userStats      map[int64]UserState
 	apiEndpoint    string
+	chatLocks      map[int64]*chatLock
+	chatLocksMu    sync.Mutex
+	payments       map[string][]Handler
+	paymentsMu     sync.RWMutex
+	// callbacks holds the callbacks of the updates being handled and whether an
+	// answerCallback request was sent for them, however it was sent.
+	callbacks   map[string]bool
+	callbacksMu sync.Mutex
 }
 
 // NewBotAPI creates a new BotAPI instance.
@@ -39,16 +82,84 @@ func NewBotAPIWithClient(token, apiEndpoint string, client *resty.Client) (*BotA
 	client.SetHeader("token", token)
 
 	bot := &BotAPI{
-		Token:       token,
-		Client:      client,
-		Handlers:    make(map[string][]Handler),
-		Middlewares: make([]Handler, 0),
-		userStats:   make(map[int64]UserState),
-		apiEndpoint: apiEndpoint,
+		Token:         token,
+		Client:        client,
+		Handlers:      make(map[string][]Handler),
+		Middlewares:   make([]Handler, 0),
+		MediaRules:    DefaultMediaRules(),
+		CallbackCodec: JSONCallbackCodec{},
+		userStats:     make(map[int64]UserState),
+		chatLocks:     make(map[int64]*chatLock),
+		payments:      make(map[string][]Handler),
+		callbacks:     make(map[string]bool),
+		apiEndpoint:   apiEndpoint,
 	}
 	return bot, nil
 }
 
+// chatLock is the send lock of a chat and the number of senders holding or
+// waiting for it.
+type chatLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lockChat serializes sends to a chat so that grouped messages are not interleaved
+// with other replies. It returns the function that releases the lock. Locks are
+// dropped once nobody holds or waits for them, so chats sent to once cost nothing.
+func (bot *BotAPI) lockChat(chatID int64) func() {
+	bot.chatLocksMu.Lock()
+	lock, ok := bot.chatLocks[chatID]
+	if !ok {
+		lock = &chatLock{}
+		bot.chatLocks[chatID] = lock
+	}
+	lock.refs++
+	bot.chatLocksMu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		bot.chatLocksMu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(bot.chatLocks, chatID)
+		}
+		bot.chatLocksMu.Unlock()
+	}
+}
+
+// trackCallback watches for answers to a callback while its update is handled and
+// returns the function that stops watching.
+func (bot *BotAPI) trackCallback(callbackID string) func() {
+	bot.callbacksMu.Lock()
+	if bot.callbacks == nil {
+		bot.callbacks = make(map[string]bool)
+	}
+	bot.callbacks[callbackID] = false
+	bot.callbacksMu.Unlock()
+	return func() {
+		bot.callbacksMu.Lock()
+		delete(bot.callbacks, callbackID)
+		bot.callbacksMu.Unlock()
+	}
+}
+
+// markCallbackAnswered records an answer to a tracked callback.
+func (bot *BotAPI) markCallbackAnswered(callbackID string) {
+	bot.callbacksMu.Lock()
+	if _, ok := bot.callbacks[callbackID]; ok {
+		bot.callbacks[callbackID] = true
+	}
+	bot.callbacksMu.Unlock()
+}
+
+func (bot *BotAPI) callbackAnswered(callbackID string) bool {
+	bot.callbacksMu.Lock()
+	defer bot.callbacksMu.Unlock()
+	return bot.callbacks[callbackID]
+}
+
 // GetHandlers retrieves handlers for a specific endpoint.
 func (bot *BotAPI) GetHandlers(endpoint string) []Handler {
 	return bot.Handlers[endpoint]
@@ -86,7 +197,10 @@ func (bot *BotAPI) MakeRequest(endpoint string, params Params) (*APIResponse, er
 			Message: apiResp.Error,
 		}
 	}
-
+	if endpoint == "answerCallback" {
+		// answered by a handler through MakeRequest, so it is not acknowledged again
+		bot.markCallbackAnswered(params["callback_id"])
+	}
 	return &apiResp, nil
 }
 
@@ -100,51 +214,96 @@ func buildParams(in Params) url.Values {
 
 // Request sends a request and handles file uploads if needed.
 func (bot *BotAPI) Request(c Chattable) (*APIResponse, error) {
+	return bot.RequestContext(context.Background(), c)
+}
+
+// RequestContext is like Request but aborts the HTTP calls when ctx is done.
+func (bot *BotAPI) RequestContext(ctx context.Context, c Chattable) (*APIResponse, error) {
+	resp, _, err := bot.request(ctx, c)
+	return resp, err
+}
+
+// request sends c and also returns the params it was sent with, including the
+// "data" of uploaded files.
+func (bot *BotAPI) request(ctx context.Context, c Chattable) (*APIResponse, Params, error) {
+	params, err := bot.prepare(ctx, c)
+	if err != nil {
+		return nil, params, err
+	}
+	resp, err := bot.post(ctx, c.method(), params)
+	return resp, params, err
+}
+
+// prepare builds the params of a Chattable, uploading its file first if it has one.
+func (bot *BotAPI) prepare(ctx context.Context, c Chattable) (Params, error) {
 	params, err := c.params()
 	if err != nil {
-		return nil, err
+		return params, err
 	}
 
 	if t, ok := c.(Fileable); ok {
-		file := t.file()
-		if hasFileNeedingUpload(file) {
-			uFile, err := bot.UploadFile(params, file)
-			if err != nil {
-				return nil, err
-			}
-			var mFile FileDta
-			mFile.File = *uFile
-			mFile.Description = params["desc"]
-			stringFileData, err := json.Marshal(mFile)
-			if err != nil {
-				return nil, err
-			}
-			params["data"] = string(stringFileData)
-		} else {
-			params["data"] = file.Data.SendData()
+		data, err := bot.fileData(ctx, params, t.file())
+		if err != nil {
+			return params, err
 		}
+		params["data"] = data
 	}
-	var apiResp APIResponse
+	return params, nil
+}
 
+// fileData returns the "data" param describing a file, uploading it first if needed.
+func (bot *BotAPI) fileData(ctx context.Context, params Params, file RequestFile) (string, error) {
+	if !hasFileNeedingUpload(file) {
+		return file.Data.SendData(), nil
+	}
+	uFile, err := bot.uploadFile(ctx, params, file)
+	if err != nil {
+		return "", err
+	}
+	if file.RoundVideo {
+		uFile.RoundVideo = true
+	}
+	var mFile FileDta
+	mFile.File = *uFile
+	mFile.Description = params["desc"]
+	stringFileData, err := json.Marshal(mFile)
+	if err != nil {
+		return "", err
+	}
+	return string(stringFileData), nil
+}
+
+func (bot *BotAPI) post(ctx context.Context, method string, params Params) (*APIResponse, error) {
+	var apiResp APIResponse
 	resp, err := bot.Client.R().
+		SetContext(ctx).
 		SetFormData(params).
 		//SetResult(&apiResp).
 		SetHeader("token", bot.Token).
-		Post(fmt.Sprintf(bot.apiEndpoint, c.method()))
+		Post(fmt.Sprintf(bot.apiEndpoint, method))
 
 	if err != nil {
 		return nil, err
 	}
 	err = json.Unmarshal(resp.Body(), &apiResp)
-	if err != nil {
+	if err != nil && !resp.IsError() {
 		return nil, err
 	}
-	if apiResp.Error != "" {
+	apiResp.Raw = resp.Body()
+	if apiResp.Error != "" || resp.IsError() {
+		message := apiResp.Error
+		if message == "" {
+			message = resp.Status()
+		}
 		return &apiResp, &Error{
-			Message: apiResp.Error,
+			Message:    message,
+			StatusCode: resp.StatusCode(),
 		}
 	}
-
+	if method == "answerCallback" {
+		// answered by a handler through Send or Request, so it is not acknowledged again
+		bot.markCallbackAnswered(params["callback_id"])
+	}
 	return &apiResp, nil
 }
 
@@ -152,8 +311,49 @@ func hasFileNeedingUpload(file RequestFile) bool {
 	return file.Data.NeedsUpload()
 }
 
-// UploadFile uploads files using Resty.
+// UploadFile uploads files using Resty. The file is checked against the bot's
+// MediaRules first, and a *MediaError is returned without contacting Gap when it fails.
 func (bot *BotAPI) UploadFile(params Params, file RequestFile) (*File, error) {
+	return bot.uploadFile(context.Background(), params, file)
+}
+
+func (bot *BotAPI) uploadFile(ctx context.Context, params Params, file RequestFile) (*File, error) {
+	if !file.Data.NeedsUpload() {
+		return nil, errors.New("no file to upload")
+	}
+
+	imageOptions := bot.imageOptions(file)
+	limit := bot.readLimit(file)
+	if imageOptions != nil && file.MaxSize == 0 {
+		// the photo may well fit the limits once it is downscaled, but it is
+		// never read past what a plain file may weigh
+		limit = bot.MediaRules[MESSAGE_TYPE_FILE].MaxSize
+		if limit == 0 {
+			limit = DefaultMaxImageSize
+		}
+	}
+	name, data, err := readUpload(file.Data, limit)
+	if err != nil {
+		return nil, err
+	}
+	var size image.Point
+	if imageOptions != nil {
+		if limit > 0 && int64(len(data)) > limit {
+			return nil, &MediaError{Type: file.Type, Name: name, Reason: MEDIA_ERROR_REASON_TOO_LARGE, Size: int64(len(data)), MaxSize: limit}
+		}
+		data, size, err = processImage(data, *imageOptions)
+		if mErr, ok := err.(*MediaError); ok {
+			mErr.Name = name
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	file, err = bot.checkMedia(params, file, name, data)
+	if err != nil {
+		return nil, err
+	}
+
 	w := &bytes.Buffer{}
 	m := multipart.NewWriter(w)
 	defer m.Close()
@@ -164,53 +364,49 @@ func (bot *BotAPI) UploadFile(params Params, file RequestFile) (*File, error) {
 		}
 	}
 
-	if file.Data.NeedsUpload() {
-		name, reader, err := file.Data.UploadData()
-		if err != nil {
-			return nil, err
-		}
+	part, err := m.CreateFormFile(file.Name, filepath.Base(name))
+	if err != nil {
+		return nil, err
+	}
+	_, err = part.Write(data)
+	if err != nil {
+		return nil, err
+	}
 
-		part, err := m.CreateFormFile(file.Name, filepath.Base(name))
-		if err != nil {
-			return nil, err
-		}
-		_, err = io.Copy(part, reader)
-		if err != nil {
-			return nil, err
-		}
+	err = m.Close()
+	if err != nil {
+		return nil, err
+	}
+	var mFile File
+	resp, err := bot.Client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", m.FormDataContentType()).
+		SetBody(w).
+		SetResult(&mFile).
+		Post(fmt.Sprintf(bot.apiEndpoint, "upload"))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println(string(resp.Body()))
 
-		err = m.Close()
+	if mFile.SID == "" {
+		var apiResp APIResponse
+		err := json.Unmarshal(resp.Body(), &apiResp)
 		if err != nil {
 			return nil, err
 		}
-		var mFile File
-		resp, err := bot.Client.R().
-			SetHeader("Content-Type", m.FormDataContentType()).
-			SetBody(w).
-			SetResult(&mFile).
-			Post(fmt.Sprintf(bot.apiEndpoint, "upload"))
-		if err != nil {
-			return nil, err
-		}
-		fmt.Println(string(resp.Body()))
-
-		if mFile.SID == "" {
-			var apiResp APIResponse
-			err := json.Unmarshal(resp.Body(), &apiResp)
-			if err != nil {
-				return nil, err
-			}
-			if apiResp.Error != "" {
-				return nil, &Error{
-					Message: apiResp.Error,
-				}
+		if apiResp.Error != "" {
+			return nil, &Error{
+				Message:    apiResp.Error,
+				StatusCode: resp.StatusCode(),
 			}
 		}
-
-		return &mFile, nil
+	}
+	if mFile.Width == 0 && mFile.Height == 0 {
+		mFile.Width, mFile.Height = int64(size.X), int64(size.Y)
 	}
 
-	return nil, errors.New("no file to upload")
+	return &mFile, nil
 }
 
 func (bot *BotAPI) MultiSend(chattables ...Chattable) ([]Message, []error) {
@@ -226,25 +422,40 @@ func (bot *BotAPI) MultiSend(chattables ...Chattable) ([]Message, []error) {
 	return messages, errors
 }
 func (bot *BotAPI) Send(c Chattable) (Message, error) {
-	resp, err := bot.Request(c)
+	return bot.SendContext(context.Background(), c)
+}
+
+// SendContext is like Send but aborts the HTTP calls when ctx is done.
+func (bot *BotAPI) SendContext(ctx context.Context, c Chattable) (Message, error) {
+	result, err := bot.SendWithResultContext(ctx, c)
+	return result.Message, err
+}
+
+// SendWithResult is like Send but also returns the response of Gap.
+func (bot *BotAPI) SendWithResult(c Chattable) (SendResult, error) {
+	return bot.SendWithResultContext(context.Background(), c)
+}
+
+// SendWithResultContext is like SendWithResult but aborts the HTTP calls when ctx is done.
+func (bot *BotAPI) SendWithResultContext(ctx context.Context, c Chattable) (SendResult, error) {
+	params, err := bot.prepare(ctx, c)
 	if err != nil {
-		return Message{}, err
+		return SendResult{}, err
 	}
-	if resp.Error != "" {
-		return Message{}, errors.New(resp.Error)
+	// uploads run unlocked, only the post itself is ordered with the chat's other sends
+	chatID, _ := strconv.ParseInt(params.GetParam("chat_id"), 10, 64)
+	unlock := bot.lockChat(chatID)
+	resp, err := bot.post(ctx, c.method(), params)
+	unlock()
+	result := SendResult{Response: resp}
+	if resp != nil {
+		result.TraceId = resp.TraceId
 	}
-	msg := Message{MessageID: resp.MessageId}
-	params, er := c.params()
-	if er != nil {
-		msg.ChatID = 0
-	} else {
-		i, err := strconv.ParseInt(params.GetParam("chat_id"), 10, 64)
-		if err != nil {
-			msg.ChatID = 0
-		}
-		msg.ChatID = i
+	if err != nil {
+		return result, err
 	}
-	return msg, err
+	result.Message = sentMessage(resp, c.method(), params)
+	return result, nil
 }
 
 func (bot *BotAPI) HandleUpdates(update []byte) (Message, error) {
@@ -259,7 +470,71 @@ func (bot *BotAPI) HandleUpdates(update []byte) (Message, error) {
 	if err != nil {
 		return Message{}, err
 	}
-	return ctx.Next()
+	if bot.TextNormalizer != nil && ctx.Message.Type == MESSAGE_TYPE_TEXT {
+		ctx.Message.Text = bot.TextNormalizer(ctx.Message.Text)
+	}
+	if ctx.CallbackError != nil {
+		return bot.handleCallbackError(&ctx)
+	}
+	if !ctx.Message.Type.IsKnown() {
+		if bot.UnknownTypeHandler != nil {
+			msg, err := bot.UnknownTypeHandler(&ctx)
+			// it runs outside Next, which stops the actions of the other handlers
+			ctx.runStops(0)
+			return msg, err
+		}
+		if bot.Debug {
+			log.Printf("routing update of unknown type %q: %s\n", ctx.Message.Type, ctx.Message.RawUpdate)
+		}
+	}
+	if bot.Ledger != nil && ctx.Message.Type == MESSAGE_TYPE_PAY_CALLBACK {
+		entry, err := bot.Ledger.Record(ctx.Context, ctx.Message.PaymentInfo)
+		switch {
+		case errors.Is(err, ErrDuplicatePayment):
+			return Message{}, nil
+		case err == nil:
+			ctx.Payment = &entry
+		case errors.Is(err, ErrPaymentFinal):
+			// e.g. paid after ExpireStale gave up on it: the handlers must reconcile it
+			ctx.Payment = &entry
+			ctx.PaymentConflict = err
+		case !errors.Is(err, ErrLedgerNotFound):
+			return Message{}, fmt.Errorf("record payment %s: %w", ctx.Message.PaymentInfo.RefId, err)
+		}
+	}
+	var trackErr error
+	if bot.Subscribers != nil && ctx.Message.Type.IsKnown() {
+		trackErr = bot.Subscribers.Track(ctx.Context, ctx.Message)
+	}
+	if callbackID := ctx.callbackID(); callbackID != "" {
+		defer bot.trackCallback(callbackID)()
+	}
+	msg, err := ctx.Next()
+	ctx.acknowledge()
+	if trackErr != nil {
+		// a registry failure is reported without keeping the update from its handlers
+		err = errors.Join(err, fmt.Errorf("track subscriber %d: %w", ctx.Message.ChatID, trackErr))
+	}
+	return msg, err
+}
+
+// handleCallbackError routes a button press whose data could not be decoded. Without
+// a handler for it the decoding error is returned once the press is answered.
+func (bot *BotAPI) handleCallbackError(ctx *Ctx) (Message, error) {
+	defer bot.trackCallback(ctx.callbackID())()
+	handler := bot.CallbackErrorHandler
+	if handler == nil {
+		handler = bot.DefaultHandler
+	}
+	if handler == nil {
+		ctx.acknowledge()
+		return Message{}, fmt.Errorf("unmarshal callback query action: %w", ctx.CallbackError)
+	}
+	msg, err := handler(ctx)
+	// it runs outside Next, which stops the actions of the other handlers
+	ctx.runStops(0)
+	ctx.acknowledge()
+	return msg, err
 }
 
 func (bot *BotAPI) Serve(port int, callbackEndpoint string) {
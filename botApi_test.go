@@ -0,0 +1,78 @@
+package gapBotApi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// newTestBot returns a bot whose API calls are served by handler, which can tell
+// the methods apart with apiMethod. Responses are sent as JSON, like Gap does.
+func newTestBot(t *testing.T, handler http.HandlerFunc) *BotAPI {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	bot, err := NewBotAPIWithClient("token", srv.URL+"/%s", resty.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bot
+}
+
+// apiMethod returns the API method a request to a test bot calls.
+func apiMethod(r *http.Request) string {
+	return strings.TrimPrefix(r.URL.Path, "/")
+}
+
+func TestSendWithResult(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Chattable
+		response string
+		err      bool
+		traceId  string
+		check    func(m Message) bool
+	}{
+		{name: "text", config: NewMessage(1, "hi"), response: `{"id":9,"trace_id":"t1"}`, traceId: "t1", check: func(m Message) bool {
+			return m.ChatID == 1 && m.MessageID == 9 && m.Type == MESSAGE_TYPE_TEXT && m.Text == "hi"
+		}},
+		{name: "edit", config: NewUpdateMessage(1, 7, "edited"), response: `{"trace_id":"t2"}`, traceId: "t2", check: func(m Message) bool {
+			return m.ChatID == 1 && m.Type == MESSAGE_TYPE_TEXT && m.Text == "edited"
+		}},
+		{name: "location", config: NewLocation(1, 35.7, 51.4), response: `{"id":10}`, check: func(m Message) bool {
+			return m.MessageID == 10 && m.Type == MESSAGE_TYPE_LOCATION && m.Location.Lat == "35.7" && m.Location.Long == "51.4"
+		}},
+		{name: "contact", config: NewContact(1, "+98912", "Sara"), response: `{"id":11}`, check: func(m Message) bool {
+			return m.Type == MESSAGE_TYPE_CONTACT && m.Contact.PhoneNumber == "+98912" && m.Contact.Name == "Sara"
+		}},
+		{name: "not a message", config: NewDeleteMessage(1, 7), response: `{"trace_id":"t3"}`, traceId: "t3", check: func(m Message) bool {
+			return m.ChatID == 1 && m.Type == "" && m.Data == ""
+		}},
+		{name: "error", config: NewMessage(1, "hi"), response: `{"error":"chat not found","trace_id":"t4"}`, err: true, traceId: "t4", check: func(m Message) bool {
+			return m.MessageID == 0
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := newTestBot(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.response))
+			})
+			result, err := bot.SendWithResult(tt.config)
+			if (err != nil) != tt.err {
+				t.Fatalf("SendWithResult() = %v, want error %v", err, tt.err)
+			}
+			if result.TraceId != tt.traceId || result.Response == nil {
+				t.Errorf("TraceId = %q with response %v, want %q", result.TraceId, result.Response, tt.traceId)
+			}
+			if !tt.check(result.Message) {
+				t.Errorf("Message = %+v", result.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package gapBotApi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultBroadcastRate is the number of messages a broadcast sends per second by default.
+const DefaultBroadcastRate = 20
+
+// Audience yields the chat IDs a broadcast is sent to.
+type Audience interface {
+	// Next returns the next chat ID, or false once the audience is exhausted.
+	Next(ctx context.Context) (int64, bool, error)
+}
+
+// AudienceFunc adapts a function to the Audience interface.
+type AudienceFunc func(ctx context.Context) (int64, bool, error)
+
+func (f AudienceFunc) Next(ctx context.Context) (int64, bool, error) {
+	return f(ctx)
+}
+
+// NewSliceAudience returns an Audience of a fixed list of chat IDs.
+func NewSliceAudience(chatIDs ...int64) Audience {
+	i := 0
+	return AudienceFunc(func(context.Context) (int64, bool, error) {
+		if i >= len(chatIDs) {
+			return 0, false, nil
+		}
+		i++
+		return chatIDs[i-1], true, nil
+	})
+}
+
+// BroadcastResult is what became of a broadcast for one recipient.
+type BroadcastResult struct {
+	ChatID    int64             `json:"chat_id"`
+	Outcome   BROADCAST_OUTCOME `json:"outcome"`
+	MessageID int64             `json:"message_id,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	At        time.Time         `json:"at"`
+}
+
+// BroadcastStats sums up a broadcast run. Recipients already handled by an
+// earlier run of the same broadcast are counted in Resumed as well as in their outcome.
+type BroadcastStats struct {
+	Total   int
+	Sent    int
+	Blocked int
+	Failed  int
+	Resumed int
+	Started time.Time
+	Elapsed time.Duration
+}
+
+func (s *BroadcastStats) add(outcome BROADCAST_OUTCOME) {
+	s.Total++
+	switch outcome {
+	case BROADCAST_OUTCOME_SENT:
+		s.Sent++
+	case BROADCAST_OUTCOME_BLOCKED:
+		s.Blocked++
+	default:
+		s.Failed++
+	}
+}
+
+// BroadcastStore keeps the per-recipient results of broadcasts, which is what
+// lets an interrupted broadcast resume where it stopped.
+type BroadcastStore interface {
+	// Record saves the result of a recipient, replacing any earlier one.
+	Record(ctx context.Context, broadcastID string, result BroadcastResult) error
+	// Result returns the recorded result of a recipient, if any.
+	Result(ctx context.Context, broadcastID string, chatID int64) (BroadcastResult, bool, error)
+	// Results returns every recorded result of a broadcast, oldest first.
+	Results(ctx context.Context, broadcastID string) ([]BroadcastResult, error)
+}
+
+// Broadcast sends one message to every chat of an Audience.
+type Broadcast struct {
+	bot *BotAPI
+	// ID identifies the broadcast in the Store. Running a broadcast again with the
+	// same ID skips the recipients it was already sent to or found blocked.
+	ID       string
+	Audience Audience
+	// Template is built, and its file uploaded, once. Its chat ID is only used for
+	// the upload and is replaced for each recipient.
+	Template Chattable
+	// Rate is the maximum number of messages sent per second.
+	Rate float64
+	// Store keeps the results of the recipients. Defaults to a MemoryBroadcastStore,
+	// which only resumes a broadcast run again in the same process; use
+	// FileBroadcastStore or another persistent store to resume after a crash or restart.
+	Store BroadcastStore
+	// Classify decides the outcome of a failed send. Defaults to ClassifyBroadcastError.
+	Classify func(err error) BROADCAST_OUTCOME
+	// OnResult is called after each recipient is handled when set.
+	OnResult func(result BroadcastResult)
+}
+
+func NewBroadcast(bot *BotAPI, id string, audience Audience, template Chattable) *Broadcast {
+	return &Broadcast{
+		bot:      bot,
+		ID:       id,
+		Audience: audience,
+		Template: template,
+		Rate:     DefaultBroadcastRate,
+		Store:    NewMemoryBroadcastStore(),
+		Classify: ClassifyBroadcastError,
+	}
+}
+
+// ClassifyBroadcastError treats API errors with the HTTP status 403 Forbidden as the
+// recipient having blocked the bot and anything else as a failure. The wording of
+// error messages is not relied on; set Broadcast.Classify to tell more cases apart.
+func ClassifyBroadcastError(err error) BROADCAST_OUTCOME {
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden {
+		return BROADCAST_OUTCOME_BLOCKED
+	}
+	return BROADCAST_OUTCOME_FAILED
+}
+
+// Run sends the broadcast until the audience is exhausted or ctx is done. Recipients
+// whose earlier send failed are tried again. When ctx is done the stats so far are
+// returned along with ctx.Err(), and running again picks up where it stopped.
+//
+// Delivery is at least once: a recipient whose message went out but whose result
+// was not recorded, because the run was interrupted in between or Store failed, is
+// sent the message again by the next run.
+func (b *Broadcast) Run(ctx context.Context) (stats BroadcastStats, err error) {
+	stats.Started = time.Now()
+	defer func() {
+		stats.Elapsed = time.Since(stats.Started)
+	}()
+
+	template, err := b.bot.prepare(ctx, b.Template)
+	if err != nil {
+		return stats, err
+	}
+	method := b.Template.method()
+	classify := b.Classify
+	if classify == nil {
+		classify = ClassifyBroadcastError
+	}
+	var interval time.Duration
+	if b.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / b.Rate)
+	}
+	next := time.Now()
+
+	for {
+		chatID, ok, err := b.Audience.Next(ctx)
+		if err != nil {
+			return stats, err
+		}
+		if !ok {
+			return stats, nil
+		}
+
+		previous, found, err := b.Store.Result(ctx, b.ID, chatID)
+		if err != nil {
+			return stats, err
+		}
+		if found && previous.Outcome != BROADCAST_OUTCOME_FAILED {
+			stats.Resumed++
+			stats.add(previous.Outcome)
+			continue
+		}
+
+		if wait := time.Until(next); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return stats, ctx.Err()
+			case <-timer.C:
+			}
+		}
+		next = time.Now().Add(interval)
+
+		request := preparedRequest{Method: method, Params: copyParams(template)}
+		request.Params["chat_id"] = strconv.FormatInt(chatID, 10)
+		message, err := b.bot.SendContext(ctx, request)
+		if err != nil && ctx.Err() != nil {
+			// interrupted, not failed: leave the recipient for the next run
+			return stats, ctx.Err()
+		}
+
+		result := BroadcastResult{ChatID: chatID, Outcome: BROADCAST_OUTCOME_SENT, MessageID: message.MessageID, At: time.Now()}
+		if err != nil {
+			result.Outcome = classify(err)
+			result.Error = err.Error()
+		}
+		if err := b.Store.Record(ctx, b.ID, result); err != nil {
+			return stats, err
+		}
+		stats.add(result.Outcome)
+		if b.OnResult != nil {
+			b.OnResult(result)
+		}
+	}
+}
+
+func copyParams(params Params) Params {
+	c := make(Params, len(params))
+	for k, v := range params {
+		c[k] = v
+	}
+	return c
+}
+
+// MemoryBroadcastStore is a BroadcastStore that keeps results in memory. They are
+// lost on restart; use FileBroadcastStore or another persistent store for that.
+type MemoryBroadcastStore struct {
+	mu      sync.RWMutex
+	results map[string]map[int64]BroadcastResult
+}
+
+func NewMemoryBroadcastStore() *MemoryBroadcastStore {
+	return &MemoryBroadcastStore{
+		results: make(map[string]map[int64]BroadcastResult),
+	}
+}
+
+func (s *MemoryBroadcastStore) Record(_ context.Context, broadcastID string, result BroadcastResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results, ok := s.results[broadcastID]
+	if !ok {
+		results = make(map[int64]BroadcastResult)
+		s.results[broadcastID] = results
+	}
+	results[result.ChatID] = result
+	return nil
+}
+
+func (s *MemoryBroadcastStore) Result(_ context.Context, broadcastID string, chatID int64) (BroadcastResult, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result, ok := s.results[broadcastID][chatID]
+	return result, ok, nil
+}
+
+func (s *MemoryBroadcastStore) Results(_ context.Context, broadcastID string) ([]BroadcastResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	results := make([]BroadcastResult, 0, len(s.results[broadcastID]))
+	for _, result := range s.results[broadcastID] {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].At.Before(results[j].At)
+	})
+	return results, nil
+}
+
+// FileBroadcastStore is a BroadcastStore that appends every result to a file of
+// JSON lines, so recording a recipient costs one write however large the broadcast.
+// The file is read once, on first use; a later line for the same recipient wins.
+type FileBroadcastStore struct {
+	Path string
+	mem  *MemoryBroadcastStore
+	once sync.Once
+	err  error
+}
+
+// fileBroadcastRecord is a line of a FileBroadcastStore.
+type fileBroadcastRecord struct {
+	BroadcastID string `json:"broadcast_id"`
+	BroadcastResult
+}
+
+func NewFileBroadcastStore(path string) *FileBroadcastStore {
+	return &FileBroadcastStore{
+		Path: path,
+		mem:  NewMemoryBroadcastStore(),
+	}
+}
+
+func (s *FileBroadcastStore) load() error {
+	s.once.Do(func() {
+		data, err := os.ReadFile(s.Path)
+		if errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		if err != nil {
+			s.err = err
+			return
+		}
+		// A crash in the middle of a write leaves a partial last line. It is cut off
+		// so the next record starts on a line of its own, and its recipient is
+		// simply sent to again.
+		if end := bytes.LastIndexByte(data, '\n') + 1; end < len(data) {
+			data = data[:end]
+			if err := os.Truncate(s.Path, int64(end)); err != nil {
+				s.err = err
+				return
+			}
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, len(data)+1)
+		for scanner.Scan() {
+			var record fileBroadcastRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				s.err = err
+				return
+			}
+			s.mem.Record(context.Background(), record.BroadcastID, record.BroadcastResult)
+		}
+		s.err = scanner.Err()
+	})
+	return s.err
+}
+
+func (s *FileBroadcastStore) Record(_ context.Context, broadcastID string, result BroadcastResult) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(fileBroadcastRecord{BroadcastID: broadcastID, BroadcastResult: result})
+	if err != nil {
+		return err
+	}
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	results, ok := s.mem.results[broadcastID]
+	if !ok {
+		results = make(map[int64]BroadcastResult)
+		s.mem.results[broadcastID] = results
+	}
+	results[result.ChatID] = result
+	return nil
+}
+
+func (s *FileBroadcastStore) Result(ctx context.Context, broadcastID string, chatID int64) (BroadcastResult, bool, error) {
+	if err := s.load(); err != nil {
+		return BroadcastResult{}, false, err
+	}
+	return s.mem.Result(ctx, broadcastID, chatID)
+}
+
+func (s *FileBroadcastStore) Results(ctx context.Context, broadcastID string) ([]BroadcastResult, error) {
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s.mem.Results(ctx, broadcastID)
+}
@@ -0,0 +1,230 @@
+package gapBotApi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClassifyBroadcastError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want BROADCAST_OUTCOME
+	}{
+		{name: "forbidden", err: &Error{Message: "Forbidden", StatusCode: http.StatusForbidden}, want: BROADCAST_OUTCOME_BLOCKED},
+		{name: "wrapped forbidden", err: fmt.Errorf("send: %w", &Error{StatusCode: http.StatusForbidden}), want: BROADCAST_OUTCOME_BLOCKED},
+		{name: "message mentions a block", err: &Error{Message: "user blocked", StatusCode: http.StatusBadRequest}, want: BROADCAST_OUTCOME_FAILED},
+		{name: "server error", err: &Error{Message: "unavailable", StatusCode: http.StatusServiceUnavailable}, want: BROADCAST_OUTCOME_FAILED},
+		{name: "network error", err: errors.New("connection refused"), want: BROADCAST_OUTCOME_FAILED},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyBroadcastError(tt.err); got != tt.want {
+				t.Errorf("ClassifyBroadcastError() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostErrorStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		message string
+	}{
+		{name: "error in body", status: http.StatusOK, body: `{"error":"chat not found"}`, message: "chat not found"},
+		{name: "error status with body", status: http.StatusForbidden, body: `{"error":"forbidden"}`, message: "forbidden"},
+		{name: "error status without body", status: http.StatusForbidden, body: `Forbidden`, message: "403 Forbidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := newTestBot(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+			_, err := bot.Send(NewMessage(1, "hi"))
+			var apiErr *Error
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("Send() = %v, want an *Error", err)
+			}
+			if apiErr.Message != tt.message || apiErr.StatusCode != tt.status {
+				t.Errorf("Error = %q with status %d, want %q with %d", apiErr.Message, apiErr.StatusCode, tt.message, tt.status)
+			}
+		})
+	}
+}
+
+// broadcastServer answers sends to chat 2 with 403 Forbidden and the first send to
+// chat 3 with a server error, and counts the sends to each chat.
+func broadcastServer(t *testing.T) (*BotAPI, func() map[string]int) {
+	var mu sync.Mutex
+	sends := make(map[string]int)
+	bot := newTestBot(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		chatID := r.FormValue("chat_id")
+		sends[chatID]++
+		switch {
+		case chatID == "2":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"error":"forbidden"}`)
+		case chatID == "3" && sends[chatID] == 1:
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error":"unavailable"}`)
+		default:
+			fmt.Fprint(w, `{"id":1}`)
+		}
+	})
+	return bot, func() map[string]int {
+		mu.Lock()
+		defer mu.Unlock()
+		counts := make(map[string]int, len(sends))
+		for k, v := range sends {
+			counts[k] = v
+		}
+		return counts
+	}
+}
+
+func TestBroadcastResume(t *testing.T) {
+	bot, sends := broadcastServer(t)
+	store := NewMemoryBroadcastStore()
+	run := func(ctx context.Context) (BroadcastStats, error) {
+		b := NewBroadcast(bot, "news", NewSliceAudience(1, 2, 3, 4), NewMessage(0, "news"))
+		b.Rate = 0
+		b.Store = store
+		return b.Run(ctx)
+	}
+
+	stats, err := run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total != 4 || stats.Sent != 2 || stats.Blocked != 1 || stats.Failed != 1 || stats.Resumed != 0 {
+		t.Errorf("first run stats = %+v", stats)
+	}
+	stats, err = run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total != 4 || stats.Sent != 3 || stats.Blocked != 1 || stats.Failed != 0 || stats.Resumed != 3 {
+		t.Errorf("second run stats = %+v", stats)
+	}
+	// only the failed recipient is sent to again
+	if got := fmt.Sprint(sends()); got != "map[1:1 2:1 3:2 4:1]" {
+		t.Errorf("sends per chat = %s", got)
+	}
+	results, err := store.Results(context.Background(), "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 {
+		t.Errorf("%d results recorded, want 4", len(results))
+	}
+}
+
+func TestBroadcastInterrupted(t *testing.T) {
+	bot, sends := broadcastServer(t)
+	store := NewMemoryBroadcastStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	b := NewBroadcast(bot, "news", NewSliceAudience(1, 4, 5), NewMessage(0, "news"))
+	b.Store = store
+	b.Rate = 1
+	b.OnResult = func(BroadcastResult) { cancel() }
+	stats, err := b.Run(ctx)
+	if !errors.Is(err, context.Canceled) || stats.Sent != 1 {
+		t.Fatalf("interrupted run = %+v, %v, want one sent and context.Canceled", stats, err)
+	}
+
+	b = NewBroadcast(bot, "news", NewSliceAudience(1, 4, 5), NewMessage(0, "news"))
+	b.Store = store
+	b.Rate = 0
+	stats, err = b.Run(context.Background())
+	if err != nil || stats.Sent != 3 || stats.Resumed != 1 {
+		t.Errorf("resumed run = %+v, %v, want three sent with one resumed", stats, err)
+	}
+	if got := fmt.Sprint(sends()); got != "map[1:1 4:1 5:1]" {
+		t.Errorf("sends per chat = %s", got)
+	}
+}
+
+func TestBroadcastRate(t *testing.T) {
+	bot, _ := broadcastServer(t)
+	b := NewBroadcast(bot, "news", NewSliceAudience(1, 4, 5, 6, 7), NewMessage(0, "news"))
+	b.Rate = 50
+	var times []time.Time
+	b.OnResult = func(BroadcastResult) { times = append(times, time.Now()) }
+	if _, err := b.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(times) != 5 {
+		t.Fatalf("%d results, want 5", len(times))
+	}
+	// five sends at 50 per second take at least four intervals of 20ms
+	if elapsed := times[4].Sub(times[0]); elapsed < 80*time.Millisecond {
+		t.Errorf("five sends took %s at 50 per second", elapsed)
+	}
+}
+
+func TestFileBroadcastStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "broadcasts.jsonl")
+	store := NewFileBroadcastStore(path)
+	at := time.Date(2026, 3, 21, 9, 0, 0, 0, time.UTC)
+	records := []struct {
+		id     string
+		result BroadcastResult
+	}{
+		{"news", BroadcastResult{ChatID: 1, Outcome: BROADCAST_OUTCOME_FAILED, Error: "unavailable", At: at}},
+		{"news", BroadcastResult{ChatID: 2, Outcome: BROADCAST_OUTCOME_BLOCKED, At: at.Add(time.Second)}},
+		{"other", BroadcastResult{ChatID: 1, Outcome: BROADCAST_OUTCOME_SENT, At: at}},
+		{"news", BroadcastResult{ChatID: 1, Outcome: BROADCAST_OUTCOME_SENT, MessageID: 9, At: at.Add(2 * time.Second)}},
+	}
+	for _, record := range records {
+		if err := store.Record(ctx, record.id, record.result); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a crash in the middle of a write leaves a partial line behind
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(f, `{"broadcast_id":"news","chat_id":3,"outc`)
+	f.Close()
+
+	reopened := NewFileBroadcastStore(path)
+	result, ok, err := reopened.Result(ctx, "news", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || result.Outcome != BROADCAST_OUTCOME_SENT || result.MessageID != 9 {
+		t.Errorf("Result() = %+v, %v, want the later sent line", result, ok)
+	}
+	if _, ok, _ := reopened.Result(ctx, "news", 3); ok {
+		t.Error("the partial line was read")
+	}
+	results, err := reopened.Results(ctx, "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].ChatID != 2 || results[1].ChatID != 1 {
+		t.Errorf("Results() = %+v, want chat 2 then chat 1", results)
+	}
+
+	if err := reopened.Record(ctx, "news", BroadcastResult{ChatID: 3, Outcome: BROADCAST_OUTCOME_SENT, At: at}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := NewFileBroadcastStore(path).Result(ctx, "news", 3); err != nil || !ok {
+		t.Errorf("record after a truncated line = %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,290 @@
+package gapBotApi
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrCallbackSignature = errors.New("callback data signature is invalid")
+	ErrCallbackExpired   = errors.New("callback data has expired")
+	ErrCallbackAnswered  = errors.New("callback is already answered")
+	ErrCallbackKey       = errors.New("callback signing key is empty")
+)
+
+// CallbackCodec turns the action of an inline keyboard button into its cb_data and back.
+type CallbackCodec interface {
+	Encode(action CallbackQueryAction) (string, error)
+	Decode(data string) (CallbackQueryAction, error)
+}
+
+// callbackCodec returns the codec of the bot, JSONCallbackCodec when it has none.
+func (bot *BotAPI) callbackCodec() CallbackCodec {
+	if bot == nil || bot.CallbackCodec == nil {
+		return JSONCallbackCodec{}
+	}
+	return bot.CallbackCodec
+}
+
+// JSONCallbackCodec stores the whole action as JSON, as earlier versions did.
+type JSONCallbackCodec struct{}
+
+func (JSONCallbackCodec) Encode(action CallbackQueryAction) (string, error) {
+	data, err := json.Marshal(action)
+	return string(data), err
+}
+
+func (JSONCallbackCodec) Decode(data string) (CallbackQueryAction, error) {
+	var action CallbackQueryAction
+	err := json.Unmarshal([]byte(data), &action)
+	return action, err
+}
+
+// CompactCallbackCodec stores the action as "state_path?key=value", which is a
+// fraction of the JSON size. A query already in the state path is decoded into
+// Params along with the others, which routes the same. JSON data from buttons sent
+// before switching to it is still decoded.
+type CompactCallbackCodec struct{}
+
+func (CompactCallbackCodec) Encode(action CallbackQueryAction) (string, error) {
+	if len(action.Params) == 0 {
+		return action.StatePath, nil
+	}
+	keys := make([]string, 0, len(action.Params))
+	for key := range action.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = url.QueryEscape(key) + "=" + url.QueryEscape(action.Params[key])
+	}
+	separator := "?"
+	if strings.Contains(action.StatePath, "?") {
+		separator = "&"
+	}
+	return action.StatePath + separator + strings.Join(values, "&"), nil
+}
+
+func (CompactCallbackCodec) Decode(data string) (CallbackQueryAction, error) {
+	if strings.HasPrefix(data, "{") {
+		return JSONCallbackCodec{}.Decode(data)
+	}
+	path, query, _ := strings.Cut(data, "?")
+	action := CallbackQueryAction{StatePath: path}
+	if query == "" {
+		return action, nil
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return action, err
+	}
+	action.Params = make(map[string]string, len(values))
+	for key := range values {
+		action.Params[key] = values.Get(key)
+	}
+	return action, nil
+}
+
+// SignedCallbackCodec appends an expiry time and an HMAC-SHA256 signature to the data
+// of another codec, so users cannot alter the params of a button or reuse it after
+// TTL. Decoding fails with ErrCallbackSignature or ErrCallbackExpired.
+type SignedCallbackCodec struct {
+	Codec CallbackCodec
+	Key   []byte
+	// TTL limits how long a button stays valid. Zero means forever.
+	TTL time.Duration
+}
+
+// NewSignedCallbackCodec signs compact callback data with key. It fails with
+// ErrCallbackKey when key is empty.
+func NewSignedCallbackCodec(key []byte, ttl time.Duration) (*SignedCallbackCodec, error) {
+	if len(key) == 0 {
+		return nil, ErrCallbackKey
+	}
+	return &SignedCallbackCodec{
+		Codec: CompactCallbackCodec{},
+		Key:   key,
+		TTL:   ttl,
+	}, nil
+}
+
+func (c *SignedCallbackCodec) Encode(action CallbackQueryAction) (string, error) {
+	if len(c.Key) == 0 {
+		return "", ErrCallbackKey
+	}
+	payload, err := c.Codec.Encode(action)
+	if err != nil {
+		return "", err
+	}
+	expiry := ""
+	if c.TTL > 0 {
+		expiry = strconv.FormatInt(time.Now().Add(c.TTL).Unix(), 36)
+	}
+	payload += "~" + expiry
+	return payload + "~" + c.sign(payload), nil
+}
+
+func (c *SignedCallbackCodec) Decode(data string) (CallbackQueryAction, error) {
+	if len(c.Key) == 0 {
+		return CallbackQueryAction{}, ErrCallbackKey
+	}
+	i := strings.LastIndex(data, "~")
+	if i < 0 {
+		return CallbackQueryAction{}, ErrCallbackSignature
+	}
+	payload, signature := data[:i], data[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(c.sign(payload))) {
+		return CallbackQueryAction{}, ErrCallbackSignature
+	}
+
+	j := strings.LastIndex(payload, "~")
+	if j < 0 {
+		return CallbackQueryAction{}, ErrCallbackSignature
+	}
+	payload, expiry := payload[:j], payload[j+1:]
+	if expiry != "" {
+		unix, err := strconv.ParseInt(expiry, 36, 64)
+		if err != nil || time.Now().Unix() > unix {
+			return CallbackQueryAction{}, ErrCallbackExpired
+		}
+	}
+	return c.Codec.Decode(payload)
+}
+
+func (c *SignedCallbackCodec) sign(payload string) string {
+	mac := hmac.New(sha256.New, c.Key)
+	mac.Write([]byte(payload))
+	// 96 bits are plenty for data that is only valid for this bot
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:12])
+}
+
+// CallbackStore keeps the actions of StoredCallbackCodec on the server.
+type CallbackStore interface {
+	Put(token string, action CallbackQueryAction, expiresAt time.Time) error
+	// Get returns false for unknown and expired tokens.
+	Get(token string) (CallbackQueryAction, bool, error)
+}
+
+// StoredCallbackCodec keeps actions in a CallbackStore and only puts a short random
+// token in the cb_data, so params never reach the client at all. Decoding unknown or
+// expired tokens fails with ErrCallbackExpired.
+type StoredCallbackCodec struct {
+	Store CallbackStore
+	// TTL limits how long a button stays valid. Zero means forever.
+	TTL time.Duration
+}
+
+func NewStoredCallbackCodec(store CallbackStore, ttl time.Duration) *StoredCallbackCodec {
+	return &StoredCallbackCodec{
+		Store: store,
+		TTL:   ttl,
+	}
+}
+
+func (c *StoredCallbackCodec) Encode(action CallbackQueryAction) (string, error) {
+	random := make([]byte, 9)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+	var expiresAt time.Time
+	if c.TTL > 0 {
+		expiresAt = time.Now().Add(c.TTL)
+	}
+	return token, c.Store.Put(token, action, expiresAt)
+}
+
+func (c *StoredCallbackCodec) Decode(data string) (CallbackQueryAction, error) {
+	action, ok, err := c.Store.Get(data)
+	if err != nil {
+		return action, err
+	}
+	if !ok {
+		return action, ErrCallbackExpired
+	}
+	return action, nil
+}
+
+// DefaultCallbackStoreSize is the number of actions a MemoryCallbackStore keeps by default.
+const DefaultCallbackStoreSize = 100_000
+
+// MemoryCallbackStore is a CallbackStore that keeps actions in memory. Once it holds
+// MaxEntries actions the oldest are dropped, whether they have expired or not, and
+// pressing their buttons fails like pressing an expired one.
+type MemoryCallbackStore struct {
+	MaxEntries int
+	mu         sync.Mutex
+	entries    map[string]storedCallback
+	// order holds the tokens oldest first, including some already deleted
+	order []string
+	puts  int
+}
+
+type storedCallback struct {
+	action    CallbackQueryAction
+	expiresAt time.Time
+}
+
+// NewMemoryCallbackStore returns a store keeping up to DefaultCallbackStoreSize
+// actions. The zero MemoryCallbackStore is ready to use and keeps any number.
+func NewMemoryCallbackStore() *MemoryCallbackStore {
+	return &MemoryCallbackStore{
+		MaxEntries: DefaultCallbackStoreSize,
+		entries:    make(map[string]storedCallback),
+	}
+}
+
+func (s *MemoryCallbackStore) Put(token string, action CallbackQueryAction, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries == nil {
+		s.entries = make(map[string]storedCallback)
+	}
+	s.entries[token] = storedCallback{action: action, expiresAt: expiresAt}
+	s.order = append(s.order, token)
+
+	// drop expired entries every now and then so the map does not grow forever
+	s.puts++
+	if s.puts%1000 == 0 {
+		now := time.Now()
+		for key, entry := range s.entries {
+			if !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+				delete(s.entries, key)
+			}
+		}
+		order := make([]string, 0, len(s.entries))
+		for _, key := range s.order {
+			if _, ok := s.entries[key]; ok {
+				order = append(order, key)
+			}
+		}
+		s.order = order
+	}
+
+	for s.MaxEntries > 0 && len(s.entries) > s.MaxEntries && len(s.order) > 0 {
+		delete(s.entries, s.order[0])
+		s.order = s.order[1:]
+	}
+	return nil
+}
+
+func (s *MemoryCallbackStore) Get(token string) (CallbackQueryAction, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[token]
+	if !ok || (!entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt)) {
+		return CallbackQueryAction{}, false, nil
+	}
+	return entry.action, true, nil
+}
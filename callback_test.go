@@ -0,0 +1,303 @@
+package gapBotApi
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// routed returns the endpoint and params an action is routed with, which is what a
+// codec has to preserve: a query in the state path ends up in the params as well.
+func routed(t *testing.T, action CallbackQueryAction) (string, map[string]interface{}) {
+	t.Helper()
+	params := make(map[string]interface{})
+	for key, value := range action.Params {
+		params[key] = value
+	}
+	query, err := parseQuery(action.StatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range query {
+		params[key] = value
+	}
+	path, _, _ := strings.Cut(action.StatePath, "?")
+	return path, params
+}
+
+var codecActions = []CallbackQueryAction{
+	{StatePath: "/menu"},
+	{StatePath: "/products", Params: map[string]string{"page": "2"}},
+	{StatePath: "/products", Params: map[string]string{"b": "2", "a": "1", "c": ""}},
+	{StatePath: "/search", Params: map[string]string{"q": "a b&c=d?e#f", "lang": "فارسی"}},
+	{StatePath: "/products?cat=1", Params: map[string]string{"page": "2"}},
+	{StatePath: "/products?cat=1&sort=price", Params: map[string]string{"page": "2", "size": "10"}},
+	{StatePath: "/products?cat=1"},
+}
+
+func TestCallbackCodecRoundTrip(t *testing.T) {
+	codecs := map[string]CallbackCodec{
+		"json":    JSONCallbackCodec{},
+		"compact": CompactCallbackCodec{},
+		"signed":  &SignedCallbackCodec{Codec: CompactCallbackCodec{}, Key: []byte("secret"), TTL: time.Hour},
+		"signed json": &SignedCallbackCodec{
+			Codec: JSONCallbackCodec{},
+			Key:   []byte("secret"),
+		},
+		"stored": NewStoredCallbackCodec(NewMemoryCallbackStore(), time.Hour),
+	}
+	for name, codec := range codecs {
+		for _, action := range codecActions {
+			t.Run(fmt.Sprintf("%s %s %v", name, action.StatePath, action.Params), func(t *testing.T) {
+				data, err := codec.Encode(action)
+				if err != nil {
+					t.Fatal(err)
+				}
+				decoded, err := codec.Decode(data)
+				if err != nil {
+					t.Fatalf("Decode(%q): %v", data, err)
+				}
+				wantPath, wantParams := routed(t, action)
+				gotPath, gotParams := routed(t, decoded)
+				if gotPath != wantPath || !reflect.DeepEqual(gotParams, wantParams) {
+					t.Errorf("Decode(%q) routes to %s %v, want %s %v", data, gotPath, gotParams, wantPath, wantParams)
+				}
+			})
+		}
+	}
+}
+
+func TestCompactCallbackCodec(t *testing.T) {
+	tests := []struct {
+		action CallbackQueryAction
+		data   string
+	}{
+		{CallbackQueryAction{StatePath: "/menu"}, "/menu"},
+		{CallbackQueryAction{StatePath: "/p", Params: map[string]string{"b": "2", "a": "1"}}, "/p?a=1&b=2"},
+		{CallbackQueryAction{StatePath: "/p", Params: map[string]string{"q": "a b&c"}}, "/p?q=a+b%26c"},
+		{CallbackQueryAction{StatePath: "/p?cat=1", Params: map[string]string{"page": "2"}}, "/p?cat=1&page=2"},
+	}
+	for _, tt := range tests {
+		data, err := CompactCallbackCodec{}.Encode(tt.action)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data != tt.data {
+			t.Errorf("Encode(%v) = %q, want %q", tt.action, data, tt.data)
+		}
+	}
+
+	decoded, err := CompactCallbackCodec{}.Decode("/p?cat=1&page=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := CallbackQueryAction{StatePath: "/p", Params: map[string]string{"cat": "1", "page": "2"}}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Errorf("Decode = %v, want %v", decoded, want)
+	}
+
+	// buttons sent before switching from JSONCallbackCodec
+	decoded, err = CompactCallbackCodec{}.Decode(`{"state_path":"/old","params":{"id":"7"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = CallbackQueryAction{StatePath: "/old", Params: map[string]string{"id": "7"}}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Errorf("Decode of JSON = %v, want %v", decoded, want)
+	}
+
+	if _, err := (CompactCallbackCodec{}).Decode("/p?a=%zz"); err == nil {
+		t.Error("Decode of an invalid query succeeded")
+	}
+}
+
+func TestSignedCallbackCodecRejects(t *testing.T) {
+	codec := &SignedCallbackCodec{Codec: CompactCallbackCodec{}, Key: []byte("secret"), TTL: time.Hour}
+	valid, err := codec.Encode(CallbackQueryAction{StatePath: "/pay", Params: map[string]string{"amount": "100"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := strings.LastIndex(valid, "~")
+	payload, signature := valid[:i], valid[i+1:]
+	signed := func(payload string) string {
+		return payload + "~" + codec.sign(payload)
+	}
+	past := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 36)
+	other := &SignedCallbackCodec{Codec: CompactCallbackCodec{}, Key: []byte("other")}
+
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{"tampered params", strings.Replace(payload, "100", "1", 1) + "~" + signature, ErrCallbackSignature},
+		{"tampered expiry", payload + "0~" + signature, ErrCallbackSignature},
+		{"tampered signature", payload + "~" + strings.ToUpper(signature), ErrCallbackSignature},
+		{"no signature", payload, ErrCallbackSignature},
+		{"no separator", "/pay", ErrCallbackSignature},
+		{"empty", "", ErrCallbackSignature},
+		{"signed without expiry separator", signed("x"), ErrCallbackSignature},
+		{"signed with another key", func() string {
+			data, _ := other.Encode(CallbackQueryAction{StatePath: "/pay"})
+			return data
+		}(), ErrCallbackSignature},
+		{"expired", signed("/pay~" + past), ErrCallbackExpired},
+		{"invalid expiry", signed("/pay~!!"), ErrCallbackExpired},
+	}
+	for _, tt := range tests {
+		if _, err := codec.Decode(tt.data); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Decode(%q) error = %v, want %v", tt.name, tt.data, err, tt.want)
+		}
+	}
+
+	if action, err := codec.Decode(signed("/pay~")); err != nil || action.StatePath != "/pay" {
+		t.Errorf("Decode without expiry = %v, %v", action, err)
+	}
+}
+
+func TestSignedCallbackCodecKey(t *testing.T) {
+	if _, err := NewSignedCallbackCodec(nil, time.Hour); !errors.Is(err, ErrCallbackKey) {
+		t.Errorf("NewSignedCallbackCodec(nil) error = %v, want %v", err, ErrCallbackKey)
+	}
+	if _, err := NewSignedCallbackCodec([]byte{}, 0); !errors.Is(err, ErrCallbackKey) {
+		t.Errorf("NewSignedCallbackCodec(empty) error = %v, want %v", err, ErrCallbackKey)
+	}
+	codec := &SignedCallbackCodec{Codec: CompactCallbackCodec{}}
+	if _, err := codec.Encode(CallbackQueryAction{StatePath: "/a"}); !errors.Is(err, ErrCallbackKey) {
+		t.Errorf("Encode without key error = %v, want %v", err, ErrCallbackKey)
+	}
+	// what an unkeyed codec would have signed
+	payload := "/a~"
+	data := payload + "~" + codec.sign(payload)
+	if _, err := codec.Decode(data); !errors.Is(err, ErrCallbackKey) {
+		t.Errorf("Decode without key error = %v, want %v", err, ErrCallbackKey)
+	}
+
+	keyed, err := NewSignedCallbackCodec([]byte("secret"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := keyed.Codec.(CompactCallbackCodec); !ok {
+		t.Errorf("NewSignedCallbackCodec wraps %T, want CompactCallbackCodec", keyed.Codec)
+	}
+}
+
+func TestStoredCallbackCodec(t *testing.T) {
+	store := NewMemoryCallbackStore()
+	codec := NewStoredCallbackCodec(store, time.Hour)
+	if _, err := codec.Decode("unknown"); !errors.Is(err, ErrCallbackExpired) {
+		t.Errorf("Decode of an unknown token error = %v, want %v", err, ErrCallbackExpired)
+	}
+
+	if err := store.Put("old", CallbackQueryAction{StatePath: "/a"}, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codec.Decode("old"); !errors.Is(err, ErrCallbackExpired) {
+		t.Errorf("Decode of an expired token error = %v, want %v", err, ErrCallbackExpired)
+	}
+
+	failing := NewStoredCallbackCodec(failingCallbackStore{}, 0)
+	if _, err := failing.Encode(CallbackQueryAction{StatePath: "/a"}); err == nil {
+		t.Error("Encode ignored the error of the store")
+	}
+}
+
+type failingCallbackStore struct{}
+
+func (failingCallbackStore) Put(string, CallbackQueryAction, time.Time) error {
+	return errors.New("store is down")
+}
+
+func (failingCallbackStore) Get(string) (CallbackQueryAction, bool, error) {
+	return CallbackQueryAction{}, false, errors.New("store is down")
+}
+
+func TestMemoryCallbackStoreMaxEntries(t *testing.T) {
+	store := NewMemoryCallbackStore()
+	store.MaxEntries = 3
+	for i := 0; i < 5; i++ {
+		if err := store.Put(strconv.Itoa(i), CallbackQueryAction{StatePath: "/" + strconv.Itoa(i)}, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		_, ok, err := store.Get(strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := i >= 2; ok != want {
+			t.Errorf("Get(%d) found = %v, want %v", i, ok, want)
+		}
+	}
+}
+
+func TestMemoryCallbackStoreZeroValue(t *testing.T) {
+	var store MemoryCallbackStore
+	if err := store.Put("t", CallbackQueryAction{StatePath: "/a"}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if action, ok, _ := store.Get("t"); !ok || action.StatePath != "/a" {
+		t.Errorf("Get() = %v, %v, want /a", action, ok)
+	}
+}
+
+func TestHandleUpdatesCallbackError(t *testing.T) {
+	update := []byte(`{"type":"triggerButton","chat_id":1,"from":{"id":42},"data":"{\"message_id\":5,\"callback_id\":\"cb\",\"data\":\"gone\"}"}`)
+	tests := []struct {
+		name         string
+		noDefault    bool
+		errorHandler bool
+		defaultCalls int
+		errorCalls   int
+		answer       string
+		err          error
+	}{
+		{name: "no handler", noDefault: true, err: ErrCallbackExpired},
+		{name: "default handler", defaultCalls: 1},
+		{name: "callback error handler", errorHandler: true, errorCalls: 1, answer: "menu expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, calls := recordingBot(t)
+			bot.CallbackCodec = NewStoredCallbackCodec(NewMemoryCallbackStore(), time.Hour)
+			var defaultCalls, errorCalls int
+			bot.Handle("/menu", func(ctx *Ctx) (Message, error) {
+				t.Error("a stale button was routed to its state")
+				return Message{}, nil
+			})
+			bot.DefaultHandler = func(ctx *Ctx) (Message, error) {
+				defaultCalls++
+				return Message{}, nil
+			}
+			if tt.noDefault {
+				bot.DefaultHandler = nil
+			}
+			if tt.errorHandler {
+				bot.CallbackErrorHandler = func(ctx *Ctx) (Message, error) {
+					errorCalls++
+					if !errors.Is(ctx.CallbackError, ErrCallbackExpired) {
+						t.Errorf("CallbackError = %v, want ErrCallbackExpired", ctx.CallbackError)
+					}
+					return ctx.Answer("menu expired")
+				}
+			}
+			_, err := bot.HandleUpdates(update)
+			if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+				t.Errorf("HandleUpdates() = %v, want %v", err, tt.err)
+			}
+			if defaultCalls != tt.defaultCalls || errorCalls != tt.errorCalls {
+				t.Errorf("DefaultHandler ran %d times and CallbackErrorHandler %d, want %d and %d", defaultCalls, errorCalls, tt.defaultCalls, tt.errorCalls)
+			}
+			if len(*calls) != 1 {
+				t.Fatalf("%d calls made, want the press answered once", len(*calls))
+			}
+			if answer := (*calls)[0]; answer.Get("method") != "answerCallback" || answer.Get("callback_id") != "cb" || answer.Get("text") != tt.answer {
+				t.Errorf("press answered with %v", answer)
+			}
+		})
+	}
+}
@@ -1,8 +1,14 @@
 package gapBotApi
 
 import (
+	"fmt"
 	"io"
+	"math"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Telegram constants
@@ -10,6 +16,9 @@ const (
 	// APIEndpoint is the Endpoint for all API methods,
 	// with formatting for Sprintf.
 	APIEndpoint = "https://api.gap.im/%s"
+
+	// DefaultMediaGroupUploads is the number of media group items uploaded in parallel.
+	DefaultMediaGroupUploads = 3
 )
 
 type MESSAGE_TYPE string
@@ -23,6 +32,7 @@ const (
 	MESSAGE_TYPE_VIDEO            MESSAGE_TYPE = "video"
 	MESSAGE_TYPE_VOICE            MESSAGE_TYPE = "voice"
 	MESSAGE_TYPE_FILE             MESSAGE_TYPE = "file"
+	MESSAGE_TYPE_STICKER          MESSAGE_TYPE = "sticker"
 	MESSAGE_TYPE_CONTACT          MESSAGE_TYPE = "contact"
 	MESSAGE_TYPE_LOCATION         MESSAGE_TYPE = "location"
 	MESSAGE_TYPE_SUBMITFORM       MESSAGE_TYPE = "submitForm"
@@ -31,6 +41,37 @@ const (
 	MESSAGE_TYPE_INVOICE_CALLBACK MESSAGE_TYPE = "invoicecallback"
 )
 
+type MEDIA_ERROR_REASON string
+
+const (
+	MEDIA_ERROR_REASON_EMPTY     MEDIA_ERROR_REASON = "empty"
+	MEDIA_ERROR_REASON_TOO_LARGE MEDIA_ERROR_REASON = "too_large"
+	MEDIA_ERROR_REASON_EXTENSION MEDIA_ERROR_REASON = "extension"
+	MEDIA_ERROR_REASON_MIME      MEDIA_ERROR_REASON = "mime"
+	// MEDIA_ERROR_REASON_DIMENSIONS is a photo with too many pixels to be processed.
+	MEDIA_ERROR_REASON_DIMENSIONS MEDIA_ERROR_REASON = "dimensions"
+)
+
+type BROADCAST_OUTCOME string
+
+const (
+	BROADCAST_OUTCOME_SENT    BROADCAST_OUTCOME = "sent"
+	BROADCAST_OUTCOME_BLOCKED BROADCAST_OUTCOME = "blocked"
+	BROADCAST_OUTCOME_FAILED  BROADCAST_OUTCOME = "failed"
+)
+
+// IsKnown reports whether updates of this type are parsed by Ctx.Unmarshal.
+func (t MESSAGE_TYPE) IsKnown() bool {
+	switch t {
+	case MESSAGE_TYPE_JOIN, MESSAGE_TYPE_LEAVE, MESSAGE_TYPE_TEXT, MESSAGE_TYPE_IMAGE, MESSAGE_TYPE_AUDIO,
+		MESSAGE_TYPE_VIDEO, MESSAGE_TYPE_VOICE, MESSAGE_TYPE_FILE, MESSAGE_TYPE_STICKER, MESSAGE_TYPE_CONTACT,
+		MESSAGE_TYPE_LOCATION, MESSAGE_TYPE_SUBMITFORM, MESSAGE_TYPE_TRIGGER_BUTTON, MESSAGE_TYPE_PAY_CALLBACK,
+		MESSAGE_TYPE_INVOICE_CALLBACK:
+		return true
+	}
+	return false
+}
+
 // Constant values for ChatActions
 const (
 	ChatTyping          = "typing"
@@ -46,6 +87,10 @@ const (
 	ChatUploadVideoNote = "upload_video_note"
 )
 
+// ChatActionInterval is how often Ctx.KeepAction re-sends a chat action,
+// which Gap clients only display for a few seconds.
+const ChatActionInterval = 4 * time.Second
+
 type INLINE_KEYBOARD_URL_OPENIN string
 
 const (
@@ -56,6 +101,14 @@ const (
 	INLINE_KEYBOARD_URL_OPENIN_WEBVIEW_WITH_HEADER INLINE_KEYBOARD_URL_OPENIN = "webview_with_header"
 )
 
+type REPLY_KEYBOARD_BUTTON_TYPE string
+
+const (
+	REPLY_KEYBOARD_BUTTON_TYPE_TEXT     REPLY_KEYBOARD_BUTTON_TYPE = "text"
+	REPLY_KEYBOARD_BUTTON_TYPE_LOCATION REPLY_KEYBOARD_BUTTON_TYPE = "$location"
+	REPLY_KEYBOARD_BUTTON_TYPE_CONTACT  REPLY_KEYBOARD_BUTTON_TYPE = "$contact"
+)
+
 type INLINE_KEYBOARD_CURRENCY string
 
 const (
@@ -63,18 +116,61 @@ const (
 	INLINE_KEYBOARD_CURRENCY_GAPCY INLINE_KEYBOARD_CURRENCY = "coin"
 )
 
+type PAYMENT_STATUS string
+
+const (
+	PAYMENT_STATUS_PENDING  PAYMENT_STATUS = "pending"
+	PAYMENT_STATUS_VERIFIED PAYMENT_STATUS = "verified"
+	PAYMENT_STATUS_PAID     PAYMENT_STATUS = "paid"
+	PAYMENT_STATUS_CANCELED PAYMENT_STATUS = "canceled"
+	PAYMENT_STATUS_EXPIRED  PAYMENT_STATUS = "expired"
+	PAYMENT_STATUS_ERROR    PAYMENT_STATUS = "error"
+)
+
+// IsFinal reports whether a payment in this status can no longer change.
+func (status PAYMENT_STATUS) IsFinal() bool {
+	switch status {
+	case PAYMENT_STATUS_VERIFIED, PAYMENT_STATUS_CANCELED, PAYMENT_STATUS_EXPIRED, PAYMENT_STATUS_ERROR:
+		return true
+	}
+	return false
+}
+
 type FORM_OBJECTS_TYPE string
 
 const (
-	FORM_OBJECTS_TYPE_TEXT     FORM_OBJECTS_TYPE = "text"
-	FORM_OBJECTS_TYPE_RADIO    FORM_OBJECTS_TYPE = "radio"
-	FORM_OBJECTS_TYPE_SELECT   FORM_OBJECTS_TYPE = "select"
-	FORM_OBJECTS_TYPE_TEXTAREA FORM_OBJECTS_TYPE = "textarea"
-	FORM_OBJECTS_TYPE_INBUILT  FORM_OBJECTS_TYPE = "inbuilt"
-	FORM_OBJECTS_TYPE_CHECKBOX FORM_OBJECTS_TYPE = "checkbox"
-	FORM_OBJECTS_TYPE_SUBMIT   FORM_OBJECTS_TYPE = "submit"
+	FORM_OBJECTS_TYPE_TEXT        FORM_OBJECTS_TYPE = "text"
+	FORM_OBJECTS_TYPE_RADIO       FORM_OBJECTS_TYPE = "radio"
+	FORM_OBJECTS_TYPE_SELECT      FORM_OBJECTS_TYPE = "select"
+	FORM_OBJECTS_TYPE_TEXTAREA    FORM_OBJECTS_TYPE = "textarea"
+	FORM_OBJECTS_TYPE_INBUILT     FORM_OBJECTS_TYPE = "inbuilt"
+	FORM_OBJECTS_TYPE_CHECKBOX    FORM_OBJECTS_TYPE = "checkbox"
+	FORM_OBJECTS_TYPE_SUBMIT      FORM_OBJECTS_TYPE = "submit"
+	FORM_OBJECTS_TYPE_NUMBER      FORM_OBJECTS_TYPE = "number"
+	FORM_OBJECTS_TYPE_DATE        FORM_OBJECTS_TYPE = "date"
+	FORM_OBJECTS_TYPE_PHONE       FORM_OBJECTS_TYPE = "phone"
+	FORM_OBJECTS_TYPE_EMAIL       FORM_OBJECTS_TYPE = "email"
+	FORM_OBJECTS_TYPE_FILE        FORM_OBJECTS_TYPE = "file"
+	FORM_OBJECTS_TYPE_MULTISELECT FORM_OBJECTS_TYPE = "multiselect"
 )
 
+// IsKnown reports whether Gap renders form objects of this type.
+func (t FORM_OBJECTS_TYPE) IsKnown() bool {
+	switch t {
+	case FORM_OBJECTS_TYPE_TEXT, FORM_OBJECTS_TYPE_RADIO, FORM_OBJECTS_TYPE_SELECT, FORM_OBJECTS_TYPE_TEXTAREA,
+		FORM_OBJECTS_TYPE_INBUILT, FORM_OBJECTS_TYPE_CHECKBOX, FORM_OBJECTS_TYPE_SUBMIT, FORM_OBJECTS_TYPE_NUMBER,
+		FORM_OBJECTS_TYPE_DATE, FORM_OBJECTS_TYPE_PHONE, FORM_OBJECTS_TYPE_EMAIL, FORM_OBJECTS_TYPE_FILE,
+		FORM_OBJECTS_TYPE_MULTISELECT:
+		return true
+	}
+	return false
+}
+
+// HasOptions reports whether form objects of this type need Options to choose from.
+func (t FORM_OBJECTS_TYPE) HasOptions() bool {
+	return t == FORM_OBJECTS_TYPE_RADIO || t == FORM_OBJECTS_TYPE_SELECT || t == FORM_OBJECTS_TYPE_MULTISELECT
+}
+
 type Chattable interface {
 	params() (Params, error)
 	method() string
@@ -91,6 +187,12 @@ type RequestFile struct {
 	Type MESSAGE_TYPE
 	// The file data to include.
 	Data RequestFileData
+	// MaxSize overrides the size ceiling of the bot's MediaRule when set.
+	MaxSize int64
+	// Image overrides the bot's ImageOptions for photos when set.
+	Image *ImageOptions
+	// RoundVideo marks an uploaded video to be shown as a round video note.
+	RoundVideo bool
 }
 
 // FileReader contains information about a reader to upload as a File.
@@ -146,6 +248,7 @@ type RequestFileData interface {
 // BaseChat is base type for all chat config types.
 type BaseChat struct {
 	ChatID               int64 // required
+	ReplyTo              int64 // id of the message being replied to
 	ReplyKeyboardMarkup  interface{}
 	InlineKeyboardMarkup InlineKeyboardMarkup
 }
@@ -153,6 +256,7 @@ type BaseChat struct {
 func (chat *BaseChat) params() (Params, error) {
 	params := make(Params)
 	params.AddFirstValid("chat_id", chat.ChatID)
+	params.AddNonZero64("reply_to", chat.ReplyTo)
 	var err error
 	if chat.ReplyKeyboardMarkup != nil {
 		err = params.AddInterface("reply_keyboard", chat.ReplyKeyboardMarkup)
@@ -167,7 +271,10 @@ type MessageConfig struct {
 	BaseChat
 	Type MESSAGE_TYPE `json:"type"`
 	Text string       `json:"data"`
-	Form []FormObject `json:"form"`
+	Form Form         `json:"form"`
+	// SkipFormValidation sends Form as is instead of checking it with Form.Validate,
+	// for legacy forms Gap renders although they do not validate.
+	SkipFormValidation bool `json:"-"`
 }
 
 func (config MessageConfig) params() (Params, error) {
@@ -178,6 +285,9 @@ func (config MessageConfig) params() (Params, error) {
 	params.AddNonEmpty("data", config.Text)
 	params.AddNonEmpty("type", "text")
 	if len(config.Form) > 0 {
+		if err := validateForm(config.Form, config.SkipFormValidation); err != nil {
+			return params, err
+		}
 		err = params.AddInterface("form", config.Form)
 	}
 
@@ -201,6 +311,7 @@ func (config UpdateMessageConfig) params() (Params, error) {
 		return params, err
 	}
 	params.AddNonEmpty("data", config.Text)
+	params.AddNonEmpty("type", string(config.Type))
 	params.AddNonZero64("message_id", config.MessageId)
 	return params, err
 }
@@ -209,6 +320,90 @@ func (config UpdateMessageConfig) method() string {
 	return "editMessage"
 }
 
+// EditInlineKeyboardConfig replaces only the inline keyboard of a message.
+// A nil InlineKeyboardMarkup removes the keyboard.
+type EditInlineKeyboardConfig struct {
+	BaseChat
+	MessageId int64 `json:"message_id"`
+}
+
+func (config EditInlineKeyboardConfig) params() (Params, error) {
+	params, err := config.BaseChat.params()
+	if err != nil {
+		return params, err
+	}
+	if config.InlineKeyboardMarkup == nil {
+		params["inline_keyboard"] = "[]"
+	}
+	params.AddNonZero64("message_id", config.MessageId)
+	return params, err
+}
+
+func (config EditInlineKeyboardConfig) method() string {
+	return "editMessage"
+}
+
+// EditFormConfig replaces the text and form of a message. An empty Form removes the form.
+type EditFormConfig struct {
+	BaseChat
+	MessageId int64  `json:"message_id"`
+	Text      string `json:"data"`
+	Form      Form   `json:"form"`
+	// SkipFormValidation sends Form as is, see MessageConfig.SkipFormValidation.
+	SkipFormValidation bool `json:"-"`
+}
+
+func (config EditFormConfig) params() (Params, error) {
+	params, err := config.BaseChat.params()
+	if err != nil {
+		return params, err
+	}
+	params.AddNonEmpty("data", config.Text)
+	params.AddNonEmpty("type", string(MESSAGE_TYPE_TEXT))
+	params.AddNonZero64("message_id", config.MessageId)
+	if len(config.Form) == 0 {
+		params["form"] = "[]"
+		return params, err
+	}
+	if err := validateForm(config.Form, config.SkipFormValidation); err != nil {
+		return params, err
+	}
+	err = params.AddInterface("form", config.Form)
+	return params, err
+}
+
+func (config EditFormConfig) method() string {
+	return "editMessage"
+}
+
+// EditCaptionConfig replaces the caption of a media message, keeping its file.
+// File is the metadata Gap returned for the media, e.g. Message.Photo.
+type EditCaptionConfig struct {
+	BaseChat
+	MessageId int64        `json:"message_id"`
+	Type      MESSAGE_TYPE `json:"type"`
+	File      File         `json:"-"`
+	Caption   string       `json:"desc"`
+}
+
+func (config EditCaptionConfig) params() (Params, error) {
+	params, err := config.BaseChat.params()
+	if err != nil {
+		return params, err
+	}
+	params.AddNonEmpty("type", string(config.Type))
+	params.AddNonZero64("message_id", config.MessageId)
+	err = params.AddInterface("data", FileDta{
+		File:        config.File,
+		Description: config.Caption,
+	})
+	return params, err
+}
+
+func (config EditCaptionConfig) method() string {
+	return "editMessage"
+}
+
 type DeleteMessageConfig struct {
 	BaseChat
 	Type      MESSAGE_TYPE `json:"type"`
@@ -229,6 +424,63 @@ func (config DeleteMessageConfig) method() string {
 	return "deleteMessage"
 }
 
+// ForwardMessageConfig forwards a message from one chat to another.
+type ForwardMessageConfig struct {
+	BaseChat
+	FromChatID int64 `json:"from_chat_id"`
+	MessageId  int64 `json:"message_id"`
+}
+
+func (config ForwardMessageConfig) params() (Params, error) {
+	params, err := config.BaseChat.params()
+	if err != nil {
+		return params, err
+	}
+	params.AddNonZero64("from_chat_id", config.FromChatID)
+	params.AddNonZero64("message_id", config.MessageId)
+	return params, err
+}
+
+func (config ForwardMessageConfig) method() string {
+	return "forwardMessage"
+}
+
+type PinMessageConfig struct {
+	BaseChat
+	MessageId int64 `json:"message_id"`
+}
+
+func (config PinMessageConfig) params() (Params, error) {
+	params, err := config.BaseChat.params()
+	if err != nil {
+		return params, err
+	}
+	params.AddNonZero64("message_id", config.MessageId)
+	return params, err
+}
+
+func (config PinMessageConfig) method() string {
+	return "pinMessage"
+}
+
+type UnpinMessageConfig struct {
+	BaseChat
+	MessageId int64 `json:"message_id"`
+}
+
+func (config UnpinMessageConfig) params() (Params, error) {
+	params, err := config.BaseChat.params()
+	if err != nil {
+		return params, err
+	}
+	params.AddNonZero64("message_id", config.MessageId)
+	return params, err
+}
+
+func (config UnpinMessageConfig) method() string {
+	return "unpinMessage"
+}
+
 type CallbackAnswerConfig struct {
 	BaseChat
 	CallbackId string `json:"callback_id"`
@@ -251,10 +503,204 @@ func (config CallbackAnswerConfig) method() string {
 	return "answerCallback"
 }
 
+type LocationConfig struct {
+	BaseChat
+	Latitude    float64
+	Longitude   float64
+	Description string
+}
+
+func (config LocationConfig) params() (Params, error) {
+	params, err := config.BaseChat.params()
+	if err != nil {
+		return params, err
+	}
+	if math.IsNaN(config.Latitude) || config.Latitude < -90 || config.Latitude > 90 {
+		return params, fmt.Errorf("latitude %v is out of range [-90, 90]", config.Latitude)
+	}
+	if math.IsNaN(config.Longitude) || config.Longitude < -180 || config.Longitude > 180 {
+		return params, fmt.Errorf("longitude %v is out of range [-180, 180]", config.Longitude)
+	}
+	err = params.AddInterface("data", Location{
+		Lat:  strconv.FormatFloat(config.Latitude, 'f', -1, 64),
+		Long: strconv.FormatFloat(config.Longitude, 'f', -1, 64),
+		Desc: config.Description,
+	})
+	params.AddNonEmpty("type", "location")
+	return params, err
+}
+
+func (config LocationConfig) method() string {
+	return "sendMessage"
+}
+
+type ContactConfig struct {
+	BaseChat
+	PhoneNumber string
+	Name        string
+}
+
+var phoneNumberPattern = regexp.MustCompile(`^\+?[0-9]{5,15}$`)
+
+func (config ContactConfig) params() (Params, error) {
+	params, err := config.BaseChat.params()
+	if err != nil {
+		return params, err
+	}
+	phone := strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(config.PhoneNumber)
+	if !phoneNumberPattern.MatchString(phone) {
+		return params, fmt.Errorf("invalid phone number %q", config.PhoneNumber)
+	}
+	// Contact would send "id":0, sent contacts have no id
+	err = params.AddInterface("data", struct {
+		PhoneNumber string `json:"phone"`
+		Name        string `json:"name,omitempty"`
+	}{
+		PhoneNumber: phone,
+		Name:        config.Name,
+	})
+	params.AddNonEmpty("type", "contact")
+	return params, err
+}
+
+func (config ContactConfig) method() string {
+	return "sendMessage"
+}
+
+// ChatActionConfig shows an action such as ChatTyping to the users of a chat.
+type ChatActionConfig struct {
+	BaseChat
+	Action string
+}
+
+func (config ChatActionConfig) params() (Params, error) {
+	params, err := config.BaseChat.params()
+	if err != nil {
+		return params, err
+	}
+	params.AddNonEmpty("type", config.Action)
+	return params, err
+}
+
+func (config ChatActionConfig) method() string {
+	return "sendAction"
+}
+
+// InvoiceConfig sends an invoice the user can pay inside Gap.
+type InvoiceConfig struct {
+	BaseChat
+	Amount      int
+	Currency    INLINE_KEYBOARD_CURRENCY
+	Description string
+	RefId       string
+	// ExpireTime is the unix time after which the invoice can no longer be paid.
+	ExpireTime int64
+}
+
+func (config InvoiceConfig) params() (Params, error) {
+	params, err := config.BaseChat.params()
+	if err != nil {
+		return params, err
+	}
+	if config.Amount <= 0 {
+		return params, fmt.Errorf("invalid invoice amount %d", config.Amount)
+	}
+	params.AddNonZero("amount", config.Amount)
+	params.AddNonEmpty("currency", string(config.Currency))
+	params.AddNonEmpty("description", config.Description)
+	params.AddNonEmpty("ref_id", config.RefId)
+	params.AddNonZero64("expire_time", config.ExpireTime)
+	return params, err
+}
+
+func (config InvoiceConfig) method() string {
+	return "invoice"
+}
+
+// InvoiceVerifyConfig confirms a paid invoice so that the payment is settled.
+type InvoiceVerifyConfig struct {
+	BaseChat
+	InvoiceId string
+}
+
+func (config InvoiceVerifyConfig) params() (Params, error) {
+	params, err := config.BaseChat.params()
+	if err != nil {
+		return params, err
+	}
+	params.AddNonEmpty("invoice_id", config.InvoiceId)
+	return params, err
+}
+
+func (config InvoiceVerifyConfig) method() string {
+	return "invoiceVerify"
+}
+
+// InvoiceInquiryConfig asks Gap for the current status of an invoice.
+type InvoiceInquiryConfig struct {
+	BaseChat
+	InvoiceId string
+}
+
+func (config InvoiceInquiryConfig) params() (Params, error) {
+	params, err := config.BaseChat.params()
+	if err != nil {
+		return params, err
+	}
+	params.AddNonEmpty("invoice_id", config.InvoiceId)
+	return params, err
+}
+
+func (config InvoiceInquiryConfig) method() string {
+	return "invoiceInquiry"
+}
+
+// PaymentVerifyConfig confirms a payment made with a payment button.
+type PaymentVerifyConfig struct {
+	BaseChat
+	RefId  string
+	Amount int
+}
+
+func (config PaymentVerifyConfig) params() (Params, error) {
+	params, err := config.BaseChat.params()
+	if err != nil {
+		return params, err
+	}
+	params.AddNonEmpty("ref_id", config.RefId)
+	params.AddNonZero("amount", config.Amount)
+	return params, err
+}
+
+func (config PaymentVerifyConfig) method() string {
+	return "payVerify"
+}
+
+// PaymentInquiryConfig asks Gap for the current status of a payment button payment.
+type PaymentInquiryConfig struct {
+	BaseChat
+	RefId string
+}
+
+func (config PaymentInquiryConfig) params() (Params, error) {
+	params, err := config.BaseChat.params()
+	if err != nil {
+		return params, err
+	}
+	params.AddNonEmpty("ref_id", config.RefId)
+	return params, err
+}
+
+func (config PaymentInquiryConfig) method() string {
+	return "payInquiry"
+}
+
 // BaseFile is a base type for all file config types.
 type BaseFile struct {
 	BaseChat
 	File RequestFileData
+	// MaxSize overrides the bot's size ceiling for this upload when set.
+	MaxSize int64
 }
 
 func (file BaseFile) params() (Params, error) {
@@ -264,6 +710,8 @@ func (file BaseFile) params() (Params, error) {
 type PhotoConfig struct {
 	BaseFile
 	Description string
+	// ImageOptions overrides BotAPI.ImageOptions for this photo.
+	ImageOptions *ImageOptions
 }
 
 func (config PhotoConfig) params() (Params, error) {
@@ -283,9 +731,11 @@ func (config PhotoConfig) method() string {
 
 func (config PhotoConfig) file() RequestFile {
 	return RequestFile{
-		Name: "image",
-		Type: MESSAGE_TYPE_IMAGE,
-		Data: config.File,
+		Name:    "image",
+		Type:    MESSAGE_TYPE_IMAGE,
+		Data:    config.File,
+		MaxSize: config.MaxSize,
+		Image:   config.ImageOptions,
 	}
 
 }
@@ -312,9 +762,10 @@ func (config VideoConfig) method() string {
 
 func (config VideoConfig) file() RequestFile {
 	return RequestFile{
-		Name: "video",
-		Type: MESSAGE_TYPE_VIDEO,
-		Data: config.File,
+		Name:    "video",
+		Type:    MESSAGE_TYPE_VIDEO,
+		Data:    config.File,
+		MaxSize: config.MaxSize,
 	}
 }
 
@@ -340,9 +791,39 @@ func (config VoiceConfig) method() string {
 
 func (config VoiceConfig) file() RequestFile {
 	return RequestFile{
-		Name: "voice",
-		Type: MESSAGE_TYPE_VOICE,
-		Data: config.File,
+		Name:    "voice",
+		Type:    MESSAGE_TYPE_VOICE,
+		Data:    config.File,
+		MaxSize: config.MaxSize,
+	}
+}
+
+// VideoNoteConfig sends a video that is shown as a round video note.
+type VideoNoteConfig struct {
+	BaseFile
+}
+
+func (config VideoNoteConfig) params() (Params, error) {
+	params, err := config.BaseFile.params()
+	if err != nil {
+		return params, err
+	}
+
+	params.AddNonEmpty("type", "video")
+	return params, err
+}
+
+func (config VideoNoteConfig) method() string {
+	return "sendMessage"
+}
+
+func (config VideoNoteConfig) file() RequestFile {
+	return RequestFile{
+		Name:       "video",
+		Type:       MESSAGE_TYPE_VIDEO,
+		Data:       config.File,
+		MaxSize:    config.MaxSize,
+		RoundVideo: true,
 	}
 }
 
@@ -368,9 +849,10 @@ func (config AudioConfig) method() string {
 
 func (config AudioConfig) file() RequestFile {
 	return RequestFile{
-		Name: "audio",
-		Type: MESSAGE_TYPE_AUDIO,
-		Data: config.File,
+		Name:    "audio",
+		Type:    MESSAGE_TYPE_AUDIO,
+		Data:    config.File,
+		MaxSize: config.MaxSize,
 	}
 }
 
@@ -396,8 +878,85 @@ func (config FileConfig) method() string {
 
 func (config FileConfig) file() RequestFile {
 	return RequestFile{
-		Name: "file",
-		Type: MESSAGE_TYPE_FILE,
-		Data: config.File,
+		Name:    "file",
+		Type:    MESSAGE_TYPE_FILE,
+		Data:    config.File,
+		MaxSize: config.MaxSize,
 	}
 }
+
+// EditMediaConfig replaces the file of a media message, uploading the new one if needed.
+type EditMediaConfig struct {
+	BaseFile
+	MessageId   int64
+	Type        MESSAGE_TYPE
+	Description string
+}
+
+func (config EditMediaConfig) params() (Params, error) {
+	params, err := config.BaseFile.params()
+	if err != nil {
+		return params, err
+	}
+	switch config.Type {
+	case MESSAGE_TYPE_IMAGE, MESSAGE_TYPE_VIDEO, MESSAGE_TYPE_AUDIO, MESSAGE_TYPE_VOICE, MESSAGE_TYPE_FILE:
+	default:
+		// it also names the form field of the upload and picks its MediaRule
+		return params, fmt.Errorf("invalid media type %q", config.Type)
+	}
+
+	params.AddNonEmpty("desc", config.Description)
+	params.AddNonEmpty("type", string(config.Type))
+	params.AddNonZero64("message_id", config.MessageId)
+	return params, err
+}
+
+func (config EditMediaConfig) method() string {
+	return "editMessage"
+}
+
+func (config EditMediaConfig) file() RequestFile {
+	return RequestFile{
+		Name:    string(config.Type),
+		Type:    config.Type,
+		Data:    config.File,
+		MaxSize: config.MaxSize,
+	}
+}
+
+type StickerConfig struct {
+	BaseFile
+}
+
+func (config StickerConfig) params() (Params, error) {
+	params, err := config.BaseFile.params()
+	if err != nil {
+		return params, err
+	}
+
+	params.AddNonEmpty("type", "sticker")
+	return params, err
+}
+
+func (config StickerConfig) method() string {
+	return "sendMessage"
+}
+
+func (config StickerConfig) file() RequestFile {
+	return RequestFile{
+		Name:    "sticker",
+		Type:    MESSAGE_TYPE_STICKER,
+		Data:    config.File,
+		MaxSize: config.MaxSize,
+	}
+}
+
+// MediaGroupConfig sends several photos, videos or other files to a chat as one
+// uninterrupted run of messages. It is sent with BotAPI.SendMediaGroup.
+type MediaGroupConfig struct {
+	ChatID int64
+	Items  []Fileable
+	// MaxParallelUploads bounds how many items are uploaded at the same time.
+	// Zero means DefaultMediaGroupUploads.
+	MaxParallelUploads int
+}
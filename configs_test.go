@@ -0,0 +1,283 @@
+package gapBotApi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// paramsOf returns the params a Chattable is sent with, failing the test on error.
+func paramsOf(t *testing.T, c Chattable) Params {
+	t.Helper()
+	params, err := c.params()
+	if err != nil {
+		t.Fatalf("%T.params(): %v", c, err)
+	}
+	return params
+}
+
+func TestVideoNoteIsRound(t *testing.T) {
+	var sent []FileDta
+	var types []string
+	bot := newTestBot(t, func(w http.ResponseWriter, r *http.Request) {
+		switch apiMethod(r) {
+		case "upload":
+			fmt.Fprint(w, `{"SID":"v","type":"video"}`)
+		case "sendMessage":
+			var file FileDta
+			if err := json.Unmarshal([]byte(r.FormValue("data")), &file); err != nil {
+				t.Error(err)
+			}
+			sent = append(sent, file)
+			types = append(types, r.FormValue("type"))
+			fmt.Fprint(w, `{"id":1}`)
+		}
+	})
+	video := FileReader{Name: "v.mp4", Reader: bytes.NewReader([]byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"))}
+	if _, err := bot.Send(NewVideoNote(1, video)); err != nil {
+		t.Fatal(err)
+	}
+	video.Reader = bytes.NewReader([]byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"))
+	if _, err := bot.Send(NewVideo(1, video)); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 2 {
+		t.Fatalf("sent %d messages, want 2", len(sent))
+	}
+	if !sent[0].RoundVideo || types[0] != "video" {
+		t.Errorf("video note sent as %s with RoundVideo %v", types[0], sent[0].RoundVideo)
+	}
+	if sent[1].RoundVideo {
+		t.Error("plain video sent as a round video")
+	}
+}
+
+func TestStickerConfig(t *testing.T) {
+	config := NewSticker(5, FilePath("s.webp"))
+	params := paramsOf(t, config)
+	if params["type"] != "sticker" || params["chat_id"] != "5" || config.method() != "sendMessage" {
+		t.Errorf("sticker params = %v, method %s", params, config.method())
+	}
+	if file := config.file(); file.Name != "sticker" || file.Type != MESSAGE_TYPE_STICKER || file.RoundVideo {
+		t.Errorf("sticker file = %+v", file)
+	}
+}
+
+func TestLocationConfig(t *testing.T) {
+	tests := []struct {
+		lat, long float64
+		want      string
+		fails     bool
+	}{
+		{lat: 35.6892, long: 51.389, want: `{"lat":"35.6892","long":"51.389","desc":"Tehran"}`},
+		{lat: -90, long: 180, want: `{"lat":"-90","long":"180","desc":"Tehran"}`},
+		{lat: 90.5, long: 0, fails: true},
+		{lat: 0, long: -180.1, fails: true},
+		{lat: math.NaN(), long: 0, fails: true},
+		{lat: 0, long: math.NaN(), fails: true},
+	}
+	for _, tt := range tests {
+		config := NewLocation(1, tt.lat, tt.long)
+		config.Description = "Tehran"
+		params, err := config.params()
+		if tt.fails {
+			if err == nil {
+				t.Errorf("params(%v, %v) accepted out of range coordinates", tt.lat, tt.long)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("params(%v, %v): %v", tt.lat, tt.long, err)
+			continue
+		}
+		if params["data"] != tt.want || params["type"] != "location" {
+			t.Errorf("params(%v, %v) = %v, want data %s", tt.lat, tt.long, params, tt.want)
+		}
+	}
+}
+
+func TestContactConfig(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string
+	}{
+		{phone: "+98 912 123-4567", want: `{"phone":"+989121234567","name":"Sara"}`},
+		{phone: "(021) 1234 5678", want: `{"phone":"02112345678","name":"Sara"}`},
+		{phone: "12ab34"},
+		{phone: "123"},
+		{phone: ""},
+	}
+	for _, tt := range tests {
+		params, err := NewContact(1, tt.phone, "Sara").params()
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("params(%q) accepted an invalid phone number", tt.phone)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("params(%q): %v", tt.phone, err)
+			continue
+		}
+		if params["data"] != tt.want || params["type"] != "contact" {
+			t.Errorf("params(%q) = %v, want data %s", tt.phone, params, tt.want)
+		}
+	}
+}
+
+func TestChatActionConfig(t *testing.T) {
+	config := NewChatAction(4, ChatUploadPhoto)
+	params := paramsOf(t, config)
+	if params["type"] != ChatUploadPhoto || params["chat_id"] != "4" || config.method() != "sendAction" {
+		t.Errorf("chat action params = %v, method %s", params, config.method())
+	}
+}
+
+func TestEditConfigParams(t *testing.T) {
+	keyboard := NewInlineKeyboardMarkup(NewInlineKeyboardRow(NewInlineKeyboardButtonURL("Site", "https://gap.im", INLINE_KEYBOARD_URL_OPENIN_BROWSER)))
+	form := NewForm(NewFormObjectInput("name", "Name"), NewFormObjectSubmit("send", "Send"))
+	tests := []struct {
+		name   string
+		config Chattable
+		want   Params
+	}{
+		{
+			name:   "keyboard",
+			config: NewEditInlineKeyboard(1, 2, keyboard),
+			want:   Params{"chat_id": "1", "message_id": "2", "inline_keyboard": `[[{"text":"Site","url":"https://gap.im","open_in":"browser"}]]`},
+		},
+		{
+			name:   "keyboard removed",
+			config: NewEditInlineKeyboard(1, 2, nil),
+			want:   Params{"chat_id": "1", "message_id": "2", "inline_keyboard": "[]"},
+		},
+		{
+			name:   "form",
+			config: NewEditForm(1, 2, "Fill in", form),
+			want:   Params{"chat_id": "1", "message_id": "2", "type": "text", "data": "Fill in", "form": `[{"name":"name","type":"text","label":"Name"},{"name":"send","type":"submit","label":"Send"}]`},
+		},
+		{
+			name:   "form removed",
+			config: NewEditForm(1, 2, "Done", nil),
+			want:   Params{"chat_id": "1", "message_id": "2", "type": "text", "data": "Done", "form": "[]"},
+		},
+		{
+			name:   "caption",
+			config: NewEditCaption(1, 2, MESSAGE_TYPE_IMAGE, File{SID: "s", Type: "image"}, "New caption"),
+			want:   Params{"chat_id": "1", "message_id": "2", "type": "image", "data": `{"SID":"s","type":"image","image_urls":{},"desc":"New caption"}`},
+		},
+		{
+			name:   "media",
+			config: EditMediaConfig{BaseFile: BaseFile{BaseChat: BaseChat{ChatID: 1}}, MessageId: 2, Type: MESSAGE_TYPE_VIDEO, Description: "Clip"},
+			want:   Params{"chat_id": "1", "message_id": "2", "type": "video", "desc": "Clip"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := paramsOf(t, tt.config); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("params = %v, want %v", got, tt.want)
+			}
+			if tt.config.method() != "editMessage" {
+				t.Errorf("method = %s, want editMessage", tt.config.method())
+			}
+		})
+	}
+}
+
+func TestEditMediaConfigType(t *testing.T) {
+	for _, typ := range []MESSAGE_TYPE{"", MESSAGE_TYPE_STICKER, MESSAGE_TYPE_TEXT, "gif"} {
+		if _, err := NewEditMedia(1, 2, typ, FilePath("a")).params(); err == nil {
+			t.Errorf("params() accepted media type %q", typ)
+		}
+	}
+	file := NewEditMedia(1, 2, MESSAGE_TYPE_AUDIO, FilePath("a.mp3")).file()
+	if file.Name != "audio" || file.Type != MESSAGE_TYPE_AUDIO {
+		t.Errorf("file() = %+v", file)
+	}
+}
+
+func TestReplyForwardPinParams(t *testing.T) {
+	reply := NewMessage(1, "hi")
+	reply.ReplyTo = 9
+	tests := []struct {
+		name   string
+		config Chattable
+		method string
+		want   Params
+	}{
+		{name: "reply", config: reply, method: "sendMessage", want: Params{"chat_id": "1", "reply_to": "9", "type": "text", "data": "hi"}},
+		{name: "forward", config: NewForward(1, 2, 3), method: "forwardMessage", want: Params{"chat_id": "1", "from_chat_id": "2", "message_id": "3"}},
+		{name: "pin", config: NewPinMessage(1, 3), method: "pinMessage", want: Params{"chat_id": "1", "message_id": "3"}},
+		{name: "unpin", config: NewUnpinMessage(1, 3), method: "unpinMessage", want: Params{"chat_id": "1", "message_id": "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := paramsOf(t, tt.config); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("params = %v, want %v", got, tt.want)
+			}
+			if tt.config.method() != tt.method {
+				t.Errorf("method = %s, want %s", tt.config.method(), tt.method)
+			}
+		})
+	}
+}
+
+func TestReplyKeyboardJSON(t *testing.T) {
+	markup := NewReplyKeyboardMarkup(
+		NewKeyboardButtonRow(NewKeyboardButton("Yes", ""), NewKeyboardButton("No", "/no")),
+		NewKeyboardButtonRow(NewKeyboardButtonLocation("Where"), NewKeyboardButtonContact("Who")),
+	)
+	want := `{"keyboard":[[{"Yes":"Yes"},{"/no":"No"}],[{"$location":"Where"},{"$contact":"Who"}]]}`
+	params := paramsOf(t, MessageConfig{BaseChat: BaseChat{ChatID: 1, ReplyKeyboardMarkup: markup}, Text: "Sure?"})
+	if got := params["reply_keyboard"]; got != want {
+		t.Errorf("reply_keyboard = %s, want %s", got, want)
+	}
+
+	var decoded ReplyKeyboardMarkup
+	if err := json.Unmarshal([]byte(want), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	// the empty value was sent as the text
+	markup.Keyboard[0][0].Value = "Yes"
+	if !reflect.DeepEqual(decoded, markup) {
+		t.Errorf("decoded %+v, want %+v", decoded, markup)
+	}
+}
+
+func TestReplyKeyboardOptionsJSON(t *testing.T) {
+	row := NewKeyboardButtonRow(NewKeyboardButton("Yes", "/yes"))
+	resized := NewReplyKeyboardMarkup(row)
+	resized.Resize = true
+	tests := []struct {
+		name string
+		msg  MessageConfig
+		want string
+	}{
+		{
+			name: "one time",
+			msg:  MessageConfig{BaseChat: BaseChat{ChatID: 1, ReplyKeyboardMarkup: NewOneTimeReplyKeyboard(row)}, Text: "Sure?"},
+			want: `{"keyboard":[[{"/yes":"Yes"}]],"once":true}`,
+		},
+		{
+			name: "resize",
+			msg:  MessageConfig{BaseChat: BaseChat{ChatID: 1, ReplyKeyboardMarkup: resized}, Text: "Sure?"},
+			want: `{"keyboard":[[{"/yes":"Yes"}]],"resize":true}`,
+		},
+		{
+			name: "remove",
+			msg:  NewRemoveKeyboard(1, "Thanks"),
+			want: `{"remove":true}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := paramsOf(t, tt.msg)["reply_keyboard"]; got != tt.want {
+				t.Errorf("reply_keyboard = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package gapBotApi
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{"* * * * *", false},
+		{"30 9 * * 1-5", false},
+		{"*/15 0-6,18-23 * * *", false},
+		{"0 12 1,15 * 0,7", false},
+		{"5/10 * * * *", false},
+		{"@daily", false},
+		{" @hourly ", false},
+		{"* * * *", true},
+		{"* * * * * *", true},
+		{"60 * * * *", true},
+		{"* 24 * * *", true},
+		{"* * 0 * *", true},
+		{"* * * 13 *", true},
+		{"* * * * 8", true},
+		{"5-1 * * * *", true},
+		{"*/0 * * * *", true},
+		{"a * * * *", true},
+		{"1-x * * * *", true},
+		{"@weekdays", true},
+	}
+	for _, tt := range tests {
+		_, err := parseCron(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCron(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	newYork := mustLocation(t, "America/New_York")
+	tehran := mustLocation(t, "Asia/Tehran")
+	utc := func(s string) time.Time {
+		return mustParseTime(t, time.UTC, s)
+	}
+	ny := func(s string) time.Time {
+		return mustParseTime(t, newYork, s)
+	}
+	// 2024-11-03 01:00-01:59 happens twice in New York, first EDT then EST
+	edt := time.FixedZone("EDT", -4*3600)
+	est := time.FixedZone("EST", -5*3600)
+
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"every minute", "* * * * *", utc("2024-01-01 10:07:30"), utc("2024-01-01 10:08:00")},
+		{"step", "*/15 * * * *", utc("2024-01-01 10:07:00"), utc("2024-01-01 10:15:00")},
+		{"step wraps the hour", "*/15 * * * *", utc("2024-01-01 10:45:00"), utc("2024-01-01 11:00:00")},
+		{"step from a value", "5/20 * * * *", utc("2024-01-01 10:26:00"), utc("2024-01-01 10:45:00")},
+		{"list and range", "0 8-9,17 * * *", utc("2024-01-01 09:30:00"), utc("2024-01-01 17:00:00")},
+		{"weekdays skip the weekend", "30 9 * * 1-5", utc("2024-01-05 10:00:00"), utc("2024-01-08 09:30:00")},
+		{"yearly", "@yearly", utc("2024-06-01 00:00:00"), utc("2025-01-01 00:00:00")},
+		{"monthly", "@monthly", utc("2024-01-31 12:00:00"), utc("2024-02-01 00:00:00")},
+		{"strictly after", "0 0 * * *", utc("2024-01-01 00:00:00"), utc("2024-01-02 00:00:00")},
+		{"day of month only", "0 0 31 * *", utc("2024-04-01 00:00:00"), utc("2024-05-31 00:00:00")},
+		{"day of week only", "0 0 * * 1", utc("2024-10-08 00:00:00"), utc("2024-10-14 00:00:00")},
+		// 2024-10-13 is a Sunday: with both day fields restricted either one matches
+		{"day of month or week, month first", "0 0 13 * 1", utc("2024-10-08 00:00:00"), utc("2024-10-13 00:00:00")},
+		{"day of month or week, week first", "0 0 20 * 1", utc("2024-10-08 00:00:00"), utc("2024-10-14 00:00:00")},
+		{"restricted step counts as restricted", "0 0 */10 * 1", utc("2024-10-02 00:00:00"), utc("2024-10-07 00:00:00")},
+		{"sunday as 0", "0 12 * * 0", utc("2024-01-01 00:00:00"), utc("2024-01-07 12:00:00")},
+		{"sunday as 7", "0 12 * * 7", utc("2024-01-01 00:00:00"), utc("2024-01-07 12:00:00")},
+		{"range up to 7", "0 12 * * 6-7", utc("2024-01-06 13:00:00"), utc("2024-01-07 12:00:00")},
+		{"weekly", "@weekly", utc("2024-01-01 00:00:00"), utc("2024-01-07 00:00:00")},
+		{"leap day", "0 0 29 2 *", utc("2024-03-01 00:00:00"), utc("2028-02-29 00:00:00")},
+		{"in the location of from", "0 9 * * *", ny("2024-01-01 10:00:00"), ny("2024-01-02 09:00:00")},
+		// 2024-03-10 02:00-02:59 does not exist in New York
+		{"skipped hour does not match", "30 2 * * *", ny("2024-03-09 03:00:00"), ny("2024-03-11 02:30:00")},
+		{"interval across spring forward", "0 * * * *", ny("2024-03-10 01:30:00"), ny("2024-03-10 03:00:00")},
+		{"fixed hour before fall back", "30 1 * * *", ny("2024-11-03 00:00:00"), time.Date(2024, 11, 3, 1, 30, 0, 0, edt)},
+		{"fixed hour runs once on fall back", "30 1 * * *", time.Date(2024, 11, 3, 1, 30, 0, 0, edt).In(newYork), ny("2024-11-04 01:30:00")},
+		{"interval runs in the repeated hour", "30 * * * *", time.Date(2024, 11, 3, 1, 30, 0, 0, edt).In(newYork), time.Date(2024, 11, 3, 1, 30, 0, 0, est)},
+		{"interval after the repeated hour", "30 * * * *", time.Date(2024, 11, 3, 1, 30, 0, 0, est).In(newYork), ny("2024-11-03 02:30:00")},
+		// Tehran moved clocks from 00:00 to 01:00 on 2022-03-22
+		{"skipped midnight", "0 0 * * *", mustParseTime(t, tehran, "2022-03-21 12:00:00"), mustParseTime(t, tehran, "2022-03-23 00:00:00")},
+		{"skipped midnight late in the day", "0 0 * * *", mustParseTime(t, tehran, "2022-03-21 23:30:00"), mustParseTime(t, tehran, "2022-03-23 00:00:00")},
+		{"skipped hour after midnight", "30 0 * * *", mustParseTime(t, tehran, "2022-03-21 12:00:00"), mustParseTime(t, tehran, "2022-03-23 00:30:00")},
+		{"hour after skipped midnight", "0 1 * * *", mustParseTime(t, tehran, "2022-03-21 12:00:00"), mustParseTime(t, tehran, "2022-03-22 01:00:00")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := parseCron(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := schedule.next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Errorf("next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+			if got.Location() != tt.from.Location() {
+				t.Errorf("next(%s) is in %s, want %s", tt.from, got.Location(), tt.from.Location())
+			}
+		})
+	}
+}
+
+func TestCronScheduleNextNeverMatches(t *testing.T) {
+	schedule, err := parseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := schedule.next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("next = %s, want the zero time", got)
+	}
+}
+
+func mustParseTime(t *testing.T, loc *time.Location, value string) time.Time {
+	t.Helper()
+	parsed, err := time.ParseInLocation("2006-01-02 15:04:05", value, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
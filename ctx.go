@@ -3,9 +3,13 @@ package gapBotApi
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 )
 
 type (
@@ -18,6 +22,16 @@ type (
 		context.Context
 		HandlerIndex uint
 		UserState    UserState
+		// Payment is the ledger entry of a pay callback when BotAPI.Ledger knows its RefId.
+		Payment *LedgerEntry
+		// PaymentConflict is an ErrPaymentFinal error when the pay callback contradicts
+		// the final status of Payment, which is left unchanged by the callback.
+		PaymentConflict error
+		// CallbackError is ErrCallbackSignature or ErrCallbackExpired when the data of
+		// the pressed button could not be decoded, see BotAPI.CallbackErrorHandler.
+		CallbackError error
+		stops         []func()
+		callback      *callbackState
 	}
 	State struct {
 		Endpoint string
@@ -27,6 +41,8 @@ type (
 	UserState struct {
 		Stack []State
 		Next  *State
+		// Locale is the language the user is spoken to in, set by Ctx.SetLocale.
+		Locale string
 	}
 )
 
@@ -74,7 +90,12 @@ func (ctx *Ctx) Handlers() []Handler {
 		parts := strings.Split(endpoint, "?")
 		endpoint = parts[0]
 	}
-	handlers = append(handlers, ctx.bot.Handlers[endpoint]...)
+	refId, isPayment := ctx.Message.paymentRef()
+	if isPayment {
+		handlers = append(handlers, ctx.bot.paymentHandlers(refId)...)
+	} else {
+		handlers = append(handlers, ctx.bot.Handlers[endpoint]...)
+	}
 	var userState UserState
 	var ok bool
 	if userState, ok = ctx.bot.userStats[ctx.Message.From.Id]; !ok {
@@ -88,7 +109,8 @@ func (ctx *Ctx) Handlers() []Handler {
 		lastState = userState.Stack[len(userState.Stack)-1]
 	}
 
-	if endpoint != "/back" && lastState.Endpoint != endpoint {
+	// Back must never replay a payment
+	if !isPayment && endpoint != "/back" && lastState.Endpoint != endpoint {
 		userState.Stack = append(userState.Stack, State{
 			Endpoint: endpoint,
 			Message:  ctx.Message,
@@ -115,11 +137,12 @@ func (ctx *Ctx) Middlewares() []Handler {
 	return ctx.bot.Middlewares
 }
 func (ctx *Ctx) ResetUserStack() {
-	_, ok := ctx.bot.userStats[ctx.Message.From.Id]
+	userState, ok := ctx.bot.userStats[ctx.Message.From.Id]
 	if ok {
 		ctx.bot.userStats[ctx.Message.From.Id] = UserState{
-			Stack: make([]State, 0),
-			Next:  nil,
+			Stack:  make([]State, 0),
+			Next:   nil,
+			Locale: userState.Locale,
 		}
 	}
 }
@@ -128,10 +151,11 @@ func (ctx *Ctx) Back() (Message, error) {
 		ctx.CleanState()
 		if len(ctx.UserState.Stack) > 0 {
 			previousCtx := &Ctx{
-				bot:     ctx.bot,
-				Message: ctx.UserState.Stack[len(ctx.UserState.Stack)-1].Message,
-				Params:  ctx.UserState.Stack[len(ctx.UserState.Stack)-1].Params,
-				Context: ctx.Context,
+				bot:      ctx.bot,
+				Message:  ctx.UserState.Stack[len(ctx.UserState.Stack)-1].Message,
+				Params:   ctx.UserState.Stack[len(ctx.UserState.Stack)-1].Params,
+				Context:  ctx.Context,
+				callback: ctx.callbackState(),
 			}
 			return previousCtx.Next()
 		}
@@ -158,18 +182,65 @@ func (ctx *Ctx) Next() (Message, error) {
 			handler := handlers[ctx.HandlerIndex]
 			if handler != nil {
 				ctx.HandlerIndex++
-				return handler(ctx)
+				mark := len(ctx.stops)
+				msg, err := handler(ctx)
+				ctx.runStops(mark)
+				return msg, err
 			}
 		}
 	}
 	return Message{}, nil
 }
 
+// KeepAction sends a chat action such as ChatTyping to the update's chat and keeps
+// re-sending it every ChatActionInterval until the calling handler returns, the
+// context is done or the returned stop function is called.
+func (ctx *Ctx) KeepAction(action string) (stop func()) {
+	done := make(chan struct{})
+	var once sync.Once
+	stop = func() {
+		once.Do(func() { close(done) })
+	}
+	ctx.stops = append(ctx.stops, stop)
+
+	reqCtx := ctx.requestContext()
+	bot, config := ctx.bot, NewChatAction(ctx.Message.ChatID, action)
+	go func() {
+		ticker := time.NewTicker(ChatActionInterval)
+		defer ticker.Stop()
+		for {
+			if _, err := bot.RequestContext(reqCtx, config); err != nil && bot.Debug {
+				log.Printf("send chat action %s: %s\n", action, err)
+			}
+			select {
+			case <-done:
+				return
+			case <-reqCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return stop
+}
+
+// runStops stops the chat actions started since the stops slice had length mark.
+func (ctx *Ctx) runStops(mark int) {
+	for i := len(ctx.stops) - 1; i >= mark; i-- {
+		ctx.stops[i]()
+	}
+	ctx.stops = ctx.stops[:mark]
+}
+
+// Unmarshal parses an update into ctx.Message. Updates of a type this package does
+// not know are kept as they are, unless BotAPI.StrictUpdates is set without a
+// BotAPI.UnknownTypeHandler, in which case an *UnknownUpdateError is returned.
 func (ctx *Ctx) Unmarshal(update []byte) error {
 	err := ctx.Message.UnmarshalJson(update)
 	if err != nil {
 		return err
 	}
+	ctx.Message.RawUpdate = append(json.RawMessage(nil), update...)
 
 	switch ctx.Message.Type {
 	case MESSAGE_TYPE_TEXT:
@@ -199,6 +270,11 @@ func (ctx *Ctx) Unmarshal(update []byte) error {
 		if err != nil {
 			return fmt.Errorf("unmarshal voice: %w", err)
 		}
+	case MESSAGE_TYPE_STICKER:
+		err = json.Unmarshal([]byte(ctx.Message.Data), &ctx.Message.Sticker)
+		if err != nil {
+			return fmt.Errorf("unmarshal sticker: %w", err)
+		}
 	case MESSAGE_TYPE_LOCATION:
 		err = json.Unmarshal([]byte(ctx.Message.Data), &ctx.Message.Location)
 		if err != nil {
@@ -214,6 +290,11 @@ func (ctx *Ctx) Unmarshal(update []byte) error {
 		if err != nil {
 			return fmt.Errorf("unmarshal payment info: %w", err)
 		}
+	case MESSAGE_TYPE_INVOICE_CALLBACK:
+		err = json.Unmarshal([]byte(ctx.Message.Data), &ctx.Message.InvoiceInfo)
+		if err != nil {
+			return fmt.Errorf("unmarshal invoice info: %w", err)
+		}
 	case MESSAGE_TYPE_SUBMITFORM:
 		err = json.Unmarshal([]byte(ctx.Message.Data), &ctx.Message.FormData)
 		if err != nil {
@@ -238,6 +319,7 @@ func (ctx *Ctx) Unmarshal(update []byte) error {
 			}
 		}
 		ctx.Message.FormData.Data = result
+		ctx.Message.FormData.Values = values
 
 	case MESSAGE_TYPE_TRIGGER_BUTTON:
 		err = json.Unmarshal([]byte(ctx.Message.Data), &ctx.Message.CallbackQuery)
@@ -245,7 +327,11 @@ func (ctx *Ctx) Unmarshal(update []byte) error {
 			return fmt.Errorf("unmarshal callback query: %w", err)
 		}
 
-		err = json.Unmarshal([]byte(ctx.Message.CallbackQuery.Data), &ctx.Message.CallbackQuery.QueryActin)
+		ctx.Message.CallbackQuery.QueryActin, err = ctx.bot.callbackCodec().Decode(ctx.Message.CallbackQuery.Data)
+		if errors.Is(err, ErrCallbackSignature) || errors.Is(err, ErrCallbackExpired) {
+			// a stale or forged button is still pressed by a user waiting for an answer
+			ctx.CallbackError, err = err, nil
+		}
 		if err != nil {
 			return fmt.Errorf("unmarshal callback query action: %w", err)
 		}
@@ -255,6 +341,10 @@ func (ctx *Ctx) Unmarshal(update []byte) error {
 		ctx.Message.Text = "/start"
 	case MESSAGE_TYPE_LEAVE:
 		ctx.Message.Text = "/leave"
+	default:
+		if ctx.bot != nil && ctx.bot.StrictUpdates && ctx.bot.UnknownTypeHandler == nil {
+			return &UnknownUpdateError{Type: ctx.Message.Type}
+		}
 	}
 	return nil
 }
@@ -266,6 +356,139 @@ func (ctx *Ctx) SetNextStat(state State) {
 	}
 }
 
+// Locale returns the locale of the user, falling back to the default locale of BotAPI.I18n.
+func (ctx *Ctx) Locale() string {
+	if ctx.UserState.Locale != "" || ctx.bot.I18n == nil {
+		return ctx.UserState.Locale
+	}
+	return ctx.bot.I18n.DefaultLocale
+}
+
+// SetLocale changes the locale the user is spoken to in from now on.
+func (ctx *Ctx) SetLocale(locale string) {
+	userState, ok := ctx.bot.userStats[ctx.Message.From.Id]
+	if !ok {
+		userState = UserState{Stack: make([]State, 0)}
+	}
+	userState.Locale = locale
+	ctx.bot.userStats[ctx.Message.From.Id] = userState
+	ctx.UserState.Locale = locale
+}
+
+// T translates a message to the locale of the user with BotAPI.I18n. The optional
+// data is what the message template renders. The key itself is returned when the
+// message is missing.
+func (ctx *Ctx) T(key string, data ...any) string {
+	if ctx.bot.I18n == nil {
+		return key
+	}
+	return ctx.bot.I18n.T(ctx.Locale(), key, firstArg(data))
+}
+
+// N is like T but picks the plural form of the message for count.
+func (ctx *Ctx) N(key string, count int, data ...any) string {
+	if ctx.bot.I18n == nil {
+		return key
+	}
+	return ctx.bot.I18n.N(ctx.Locale(), key, count, firstArg(data))
+}
+
+func firstArg(args []any) any {
+	if len(args) == 0 {
+		return nil
+	}
+	return args[0]
+}
+
+// callbackState is the update received from Gap and whether its callback is
+// answered. Back shares it with the context it re-runs handlers in, so they answer
+// and edit the press being handled rather than the one stored in the stack.
+type callbackState struct {
+	message  *Message
+	answered bool
+}
+
+func (ctx *Ctx) callbackState() *callbackState {
+	if ctx.callback == nil {
+		ctx.callback = &callbackState{message: ctx.Message}
+	}
+	return ctx.callback
+}
+
+// callbackID returns the id Gap expects an answer for, if the update has one.
+func (ctx *Ctx) callbackID() string {
+	message := ctx.callbackState().message
+	switch message.Type {
+	case MESSAGE_TYPE_TRIGGER_BUTTON:
+		return message.CallbackQuery.CallbackId
+	case MESSAGE_TYPE_SUBMITFORM:
+		return message.FormData.CallbackID
+	}
+	return ""
+}
+
+// Answer answers the button press or form submission being handled with a short
+// notification. A callback can only be answered once; later calls return
+// ErrCallbackAnswered.
+func (ctx *Ctx) Answer(text string) (Message, error) {
+	return ctx.answer(text, false)
+}
+
+// Alert answers the callback being handled with an alert the user has to dismiss.
+func (ctx *Ctx) Alert(text string) (Message, error) {
+	return ctx.answer(text, true)
+}
+
+func (ctx *Ctx) answer(text string, showAlert bool) (Message, error) {
+	state := ctx.callbackState()
+	callbackID := ctx.callbackID()
+	if callbackID == "" {
+		return Message{}, fmt.Errorf("%s update has no callback to answer", state.message.Type)
+	}
+	if state.answered || ctx.bot.callbackAnswered(callbackID) {
+		return Message{}, ErrCallbackAnswered
+	}
+	msg, err := ctx.send(NewAnswerCallback(state.message.ChatID, callbackID, text, showAlert))
+	if err == nil {
+		state.answered = true
+	}
+	return msg, err
+}
+
+// acknowledge answers a callback the handlers left unanswered, so the client stops
+// waiting for it. Answers sent with BotAPI.Send or Request count too.
+func (ctx *Ctx) acknowledge() {
+	callbackID := ctx.callbackID()
+	if ctx.callbackState().answered || callbackID == "" || ctx.bot.callbackAnswered(callbackID) {
+		return
+	}
+	if _, err := ctx.answer("", false); err != nil && ctx.bot.Debug {
+		log.Printf("acknowledge callback: %s\n", err)
+	}
+}
+
+// EditCallbackMessage replaces the text and inline keyboard of the message whose
+// button was pressed.
+func (ctx *Ctx) EditCallbackMessage(text string, markup InlineKeyboardMarkup) (Message, error) {
+	pressed := ctx.callbackState().message
+	if pressed.Type != MESSAGE_TYPE_TRIGGER_BUTTON {
+		return Message{}, fmt.Errorf("%s update does not come from a button", pressed.Type)
+	}
+	msg := NewUpdateMessage(pressed.ChatID, pressed.MessageID, text)
+	msg.InlineKeyboardMarkup = markup
+	return ctx.send(msg)
+}
+
+// EditCallbackKeyboard replaces only the inline keyboard of the message whose button
+// was pressed. A nil markup removes the keyboard.
+func (ctx *Ctx) EditCallbackKeyboard(markup InlineKeyboardMarkup) (Message, error) {
+	pressed := ctx.callbackState().message
+	if pressed.Type != MESSAGE_TYPE_TRIGGER_BUTTON {
+		return Message{}, fmt.Errorf("%s update does not come from a button", pressed.Type)
+	}
+	return ctx.send(NewEditInlineKeyboard(pressed.ChatID, pressed.MessageID, markup))
+}
+
 func (ctx *Ctx) Bot() *BotAPI {
 	return ctx.bot
 }
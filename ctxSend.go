@@ -0,0 +1,170 @@
+package gapBotApi
+
+import "context"
+
+// SendOption customizes the messages sent by the Ctx helpers.
+type SendOption func(*sendOptions)
+
+type sendOptions struct {
+	replyTo        int64
+	replyKeyboard  interface{}
+	inlineKeyboard InlineKeyboardMarkup
+	form           Form
+}
+
+// WithReplyTo sends the message as a reply to another message.
+func WithReplyTo(messageID int64) SendOption {
+	return func(o *sendOptions) {
+		o.replyTo = messageID
+	}
+}
+
+// WithReplyKeyboard attaches a ReplyKeyboardMarkup or ReplyKeyboardRemove.
+func WithReplyKeyboard(markup interface{}) SendOption {
+	return func(o *sendOptions) {
+		o.replyKeyboard = markup
+	}
+}
+
+// WithInlineKeyboard attaches an inline keyboard.
+func WithInlineKeyboard(markup InlineKeyboardMarkup) SendOption {
+	return func(o *sendOptions) {
+		o.inlineKeyboard = markup
+	}
+}
+
+// WithForm attaches a form. It only applies to text messages.
+func WithForm(form Form) SendOption {
+	return func(o *sendOptions) {
+		o.form = form
+	}
+}
+
+func newSendOptions(opts []SendOption) sendOptions {
+	var o sendOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (o sendOptions) apply(chat *BaseChat) {
+	if o.replyTo != 0 {
+		chat.ReplyTo = o.replyTo
+	}
+	if o.replyKeyboard != nil {
+		chat.ReplyKeyboardMarkup = o.replyKeyboard
+	}
+	if o.inlineKeyboard != nil {
+		chat.InlineKeyboardMarkup = o.inlineKeyboard
+	}
+}
+
+// requestContext is the context the requests made while handling the update run with.
+func (ctx *Ctx) requestContext() context.Context {
+	if ctx.Context == nil {
+		return context.Background()
+	}
+	return ctx.Context
+}
+
+func (ctx *Ctx) send(c Chattable) (Message, error) {
+	return ctx.bot.SendContext(ctx.requestContext(), c)
+}
+
+// Send sends a text message to the update's chat.
+func (ctx *Ctx) Send(text string, opts ...SendOption) (Message, error) {
+	o := newSendOptions(opts)
+	msg := NewMessage(ctx.Message.ChatID, text)
+	o.apply(&msg.BaseChat)
+	msg.Form = o.form
+	return ctx.send(msg)
+}
+
+// SendForm sends a text message with a form to the update's chat.
+func (ctx *Ctx) SendForm(text string, form Form, opts ...SendOption) (Message, error) {
+	return ctx.Send(text, append(opts, WithForm(form))...)
+}
+
+// Reply sends a text message to the update's chat as a reply to the update's message.
+func (ctx *Ctx) Reply(text string, opts ...SendOption) (Message, error) {
+	return ctx.Send(text, append(opts, WithReplyTo(ctx.Message.MessageID))...)
+}
+
+// SendPhoto sends a photo with a caption to the update's chat.
+func (ctx *Ctx) SendPhoto(file RequestFileData, caption string, opts ...SendOption) (Message, error) {
+	msg := NewPhoto(ctx.Message.ChatID, file)
+	msg.Description = caption
+	newSendOptions(opts).apply(&msg.BaseChat)
+	return ctx.send(msg)
+}
+
+// SendVideo sends a video with a caption to the update's chat.
+func (ctx *Ctx) SendVideo(file RequestFileData, caption string, opts ...SendOption) (Message, error) {
+	msg := NewVideo(ctx.Message.ChatID, file)
+	msg.Description = caption
+	newSendOptions(opts).apply(&msg.BaseChat)
+	return ctx.send(msg)
+}
+
+// SendVoice sends a voice message with a caption to the update's chat.
+func (ctx *Ctx) SendVoice(file RequestFileData, caption string, opts ...SendOption) (Message, error) {
+	msg := NewVoice(ctx.Message.ChatID, file)
+	msg.Description = caption
+	newSendOptions(opts).apply(&msg.BaseChat)
+	return ctx.send(msg)
+}
+
+// SendAudio sends an audio file with a caption to the update's chat.
+func (ctx *Ctx) SendAudio(file RequestFileData, caption string, opts ...SendOption) (Message, error) {
+	msg := NewAudio(ctx.Message.ChatID, file)
+	msg.Description = caption
+	newSendOptions(opts).apply(&msg.BaseChat)
+	return ctx.send(msg)
+}
+
+// SendFile sends a file with a caption to the update's chat.
+func (ctx *Ctx) SendFile(file RequestFileData, caption string, opts ...SendOption) (Message, error) {
+	msg := NewFile(ctx.Message.ChatID, file)
+	msg.Description = caption
+	newSendOptions(opts).apply(&msg.BaseChat)
+	return ctx.send(msg)
+}
+
+// SendLocation sends a location to the update's chat.
+func (ctx *Ctx) SendLocation(latitude, longitude float64, opts ...SendOption) (Message, error) {
+	msg := NewLocation(ctx.Message.ChatID, latitude, longitude)
+	newSendOptions(opts).apply(&msg.BaseChat)
+	return ctx.send(msg)
+}
+
+// SendContact sends a contact to the update's chat.
+func (ctx *Ctx) SendContact(phoneNumber, name string, opts ...SendOption) (Message, error) {
+	msg := NewContact(ctx.Message.ChatID, phoneNumber, name)
+	newSendOptions(opts).apply(&msg.BaseChat)
+	return ctx.send(msg)
+}
+
+// Edit replaces the text of the update's message, which for button presses is the
+// message holding the button. Keyboards and forms passed as options are replaced too.
+func (ctx *Ctx) Edit(text string, opts ...SendOption) (Message, error) {
+	o := newSendOptions(opts)
+	if o.form != nil {
+		msg := NewEditForm(ctx.Message.ChatID, ctx.Message.MessageID, text, o.form)
+		o.apply(&msg.BaseChat)
+		return ctx.send(msg)
+	}
+	msg := NewUpdateMessage(ctx.Message.ChatID, ctx.Message.MessageID, text)
+	o.apply(&msg.BaseChat)
+	return ctx.send(msg)
+}
+
+// Delete deletes the update's message.
+func (ctx *Ctx) Delete() (Message, error) {
+	return ctx.send(NewDeleteMessage(ctx.Message.ChatID, ctx.Message.MessageID))
+}
+
+// Forward forwards the update's message to another chat, e.g. an operator chat.
+func (ctx *Ctx) Forward(chatID int64) (Message, error) {
+	return ctx.send(NewForward(chatID, ctx.Message.ChatID, ctx.Message.MessageID))
+}
@@ -0,0 +1,176 @@
+package gapBotApi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// recordingBot returns a test bot that answers every call with message id 1, and
+// uploads with file SID f, and the calls it received.
+func recordingBot(t *testing.T) (*BotAPI, *[]url.Values) {
+	t.Helper()
+	var calls []url.Values
+	bot := newTestBot(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		r.PostForm.Set("method", apiMethod(r))
+		calls = append(calls, r.PostForm)
+		if apiMethod(r) == "upload" {
+			fmt.Fprint(w, `{"SID":"f"}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	return bot, &calls
+}
+
+func TestCtxReplyAndForward(t *testing.T) {
+	bot, calls := recordingBot(t)
+	ctx := newTestCtx(bot, &Message{ChatID: 1, MessageID: 7, Type: MESSAGE_TYPE_TEXT, Text: "hello"})
+	if _, err := ctx.Reply("hi"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.Forward(2); err != nil {
+		t.Fatal(err)
+	}
+	if len(*calls) != 2 {
+		t.Fatalf("%d calls, want 2", len(*calls))
+	}
+	reply, forward := (*calls)[0], (*calls)[1]
+	if reply.Get("method") != "sendMessage" || reply.Get("chat_id") != "1" || reply.Get("reply_to") != "7" || reply.Get("data") != "hi" {
+		t.Errorf("reply sent as %v", reply)
+	}
+	if forward.Get("method") != "forwardMessage" || forward.Get("chat_id") != "2" || forward.Get("from_chat_id") != "1" || forward.Get("message_id") != "7" {
+		t.Errorf("forward sent as %v", forward)
+	}
+}
+
+// jsonOf returns v encoded as JSON, failing the test on error.
+func jsonOf(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCtxSend(t *testing.T) {
+	replyKeyboard := NewReplyKeyboardMarkup(NewKeyboardButtonRow(NewKeyboardButton("Yes", "/yes")))
+	inlineKeyboard := NewInlineKeyboardMarkup(NewInlineKeyboardRow(InlineKeyboardButton{Text: "Open", URL: "https://gap.im"}))
+	form := NewForm(NewFormObjectInput("name", "Name"), NewFormObjectSubmit("send", "Send"))
+	options := []SendOption{WithReplyTo(3), WithReplyKeyboard(replyKeyboard), WithInlineKeyboard(inlineKeyboard)}
+	file := func(name string, data []byte) FileReader {
+		return FileReader{Name: name, Reader: bytes.NewReader(data)}
+	}
+	// the params each call must be sent with, where an empty value must be missing
+	tests := []struct {
+		name string
+		send func(ctx *Ctx) (Message, error)
+		want map[string]string
+	}{
+		{
+			name: "send",
+			send: func(ctx *Ctx) (Message, error) { return ctx.Send("hi") },
+			want: map[string]string{"method": "sendMessage", "chat_id": "1", "type": "text", "data": "hi", "reply_to": "", "reply_keyboard": "", "inline_keyboard": "", "form": ""},
+		},
+		{
+			name: "send with options",
+			send: func(ctx *Ctx) (Message, error) { return ctx.Send("hi", options...) },
+			want: map[string]string{"method": "sendMessage", "chat_id": "1", "data": "hi", "reply_to": "3", "reply_keyboard": jsonOf(t, replyKeyboard), "inline_keyboard": jsonOf(t, inlineKeyboard)},
+		},
+		{
+			name: "send form",
+			send: func(ctx *Ctx) (Message, error) { return ctx.SendForm("who?", form, WithReplyTo(3)) },
+			want: map[string]string{"method": "sendMessage", "chat_id": "1", "data": "who?", "reply_to": "3", "form": jsonOf(t, form)},
+		},
+		{
+			name: "photo",
+			send: func(ctx *Ctx) (Message, error) {
+				return ctx.SendPhoto(file("a.jpg", jpegData), "look", options...)
+			},
+			want: map[string]string{"method": "sendMessage", "chat_id": "1", "type": "image", "desc": "look", "reply_to": "3", "reply_keyboard": jsonOf(t, replyKeyboard), "inline_keyboard": jsonOf(t, inlineKeyboard)},
+		},
+		{
+			name: "video",
+			send: func(ctx *Ctx) (Message, error) {
+				return ctx.SendVideo(file("v.mp4", []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom")), "watch", WithReplyTo(3))
+			},
+			want: map[string]string{"method": "sendMessage", "chat_id": "1", "type": "video", "desc": "watch", "reply_to": "3"},
+		},
+		{
+			name: "voice",
+			send: func(ctx *Ctx) (Message, error) {
+				return ctx.SendVoice(file("a.amr", []byte{0x01, 0x02, 0x03}), "listen", WithInlineKeyboard(inlineKeyboard))
+			},
+			want: map[string]string{"method": "sendMessage", "chat_id": "1", "type": "voice", "desc": "listen", "inline_keyboard": jsonOf(t, inlineKeyboard)},
+		},
+		{
+			name: "audio",
+			send: func(ctx *Ctx) (Message, error) {
+				return ctx.SendAudio(file("a.mp3", []byte("ID3\x03\x00\x00\x00\x00\x00\x00")), "song", WithReplyKeyboard(replyKeyboard))
+			},
+			want: map[string]string{"method": "sendMessage", "chat_id": "1", "type": "audio", "desc": "song", "reply_keyboard": jsonOf(t, replyKeyboard)},
+		},
+		{
+			name: "file",
+			send: func(ctx *Ctx) (Message, error) {
+				return ctx.SendFile(file("notes", textData), "notes", WithReplyTo(3))
+			},
+			want: map[string]string{"method": "sendMessage", "chat_id": "1", "type": "file", "desc": "notes", "reply_to": "3"},
+		},
+		{
+			name: "location",
+			send: func(ctx *Ctx) (Message, error) { return ctx.SendLocation(35.6892, 51.389, options...) },
+			want: map[string]string{"method": "sendMessage", "chat_id": "1", "type": "location", "data": `{"lat":"35.6892","long":"51.389"}`, "reply_to": "3", "reply_keyboard": jsonOf(t, replyKeyboard), "inline_keyboard": jsonOf(t, inlineKeyboard)},
+		},
+		{
+			name: "contact",
+			send: func(ctx *Ctx) (Message, error) { return ctx.SendContact("+98 912 000 0000", "Ali", WithReplyTo(3)) },
+			want: map[string]string{"method": "sendMessage", "chat_id": "1", "type": "contact", "data": `{"phone":"+989120000000","name":"Ali"}`, "reply_to": "3"},
+		},
+		{
+			name: "edit",
+			send: func(ctx *Ctx) (Message, error) { return ctx.Edit("edited", WithInlineKeyboard(inlineKeyboard)) },
+			want: map[string]string{"method": "editMessage", "chat_id": "1", "message_id": "7", "data": "edited", "inline_keyboard": jsonOf(t, inlineKeyboard), "form": ""},
+		},
+		{
+			name: "edit with form",
+			send: func(ctx *Ctx) (Message, error) {
+				return ctx.Edit("who?", WithForm(form), WithInlineKeyboard(inlineKeyboard))
+			},
+			want: map[string]string{"method": "editMessage", "chat_id": "1", "message_id": "7", "type": "text", "data": "who?", "form": jsonOf(t, form), "inline_keyboard": jsonOf(t, inlineKeyboard)},
+		},
+		{
+			name: "delete",
+			send: func(ctx *Ctx) (Message, error) { return ctx.Delete() },
+			want: map[string]string{"method": "deleteMessage", "chat_id": "1", "message_id": "7", "data": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, calls := recordingBot(t)
+			ctx := newTestCtx(bot, &Message{ChatID: 1, MessageID: 7, Type: MESSAGE_TYPE_TEXT, Text: "hello"})
+			if _, err := tt.send(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if len(*calls) == 0 {
+				t.Fatal("nothing sent")
+			}
+			// media are uploaded first
+			call := (*calls)[len(*calls)-1]
+			for key, want := range tt.want {
+				if want == "" && call.Has(key) {
+					t.Errorf("%s = %q, want it missing", key, call.Get(key))
+				} else if got := call.Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package gapBotApi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newTestCtx returns the context an update is handled in by a test bot.
+func newTestCtx(bot *BotAPI, message *Message) *Ctx {
+	return &Ctx{bot: bot, Message: message, Context: context.Background(), Params: make(map[string]interface{})}
+}
+
+func TestKeepActionStopsWithHandler(t *testing.T) {
+	actions := make(chan string, 10)
+	bot := newTestBot(t, func(w http.ResponseWriter, r *http.Request) {
+		if apiMethod(r) == "sendAction" {
+			actions <- r.FormValue("chat_id") + " " + r.FormValue("type")
+		}
+		fmt.Fprint(w, `{}`)
+	})
+	var stop func()
+	bot.Handle("/slow", func(ctx *Ctx) (Message, error) {
+		stop = ctx.KeepAction(ChatTyping)
+		if len(ctx.stops) != 1 {
+			t.Errorf("%d actions kept, want 1", len(ctx.stops))
+		}
+		return Message{}, nil
+	})
+	ctx := newTestCtx(bot, &Message{ChatID: 3, Type: MESSAGE_TYPE_TEXT, Text: "/slow"})
+	if _, err := ctx.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ctx.stops) != 0 {
+		t.Errorf("%d actions still kept after the handler returned", len(ctx.stops))
+	}
+	select {
+	case action := <-actions:
+		if action != "3 typing" {
+			t.Errorf("sent action %q, want %q", action, "3 typing")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no chat action was sent")
+	}
+	// stopping again, e.g. with a deferred stop, is harmless
+	stop()
+}
+
+func TestUnmarshalUpdateTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		typ   MESSAGE_TYPE
+		data  string
+		check func(*Message) bool
+	}{
+		{"text", MESSAGE_TYPE_TEXT, "hello", func(m *Message) bool { return m.Text == "hello" }},
+		{"image", MESSAGE_TYPE_IMAGE, `{"SID":"i","width":10}`, func(m *Message) bool { return m.Photo.SID == "i" && m.Photo.Width == 10 }},
+		{"video", MESSAGE_TYPE_VIDEO, `{"SID":"v","duration":1.5}`, func(m *Message) bool { return m.Video.SID == "v" && m.Video.Duration == 1.5 }},
+		{"voice", MESSAGE_TYPE_VOICE, `{"SID":"vo"}`, func(m *Message) bool { return m.Voice.SID == "vo" }},
+		{"audio", MESSAGE_TYPE_AUDIO, `{"SID":"a"}`, func(m *Message) bool { return m.Audio.SID == "a" }},
+		{"file", MESSAGE_TYPE_FILE, `{"SID":"f","filename":"a.pdf"}`, func(m *Message) bool { return m.File.Filename == "a.pdf" }},
+		{"sticker", MESSAGE_TYPE_STICKER, `{"SID":"s"}`, func(m *Message) bool { return m.Sticker.SID == "s" }},
+		{"location", MESSAGE_TYPE_LOCATION, `{"lat":"35.7","long":"51.4"}`, func(m *Message) bool { return m.Location.Lat == "35.7" && m.Location.Long == "51.4" }},
+		{"contact", MESSAGE_TYPE_CONTACT, `{"id":3,"phone":"0912","name":"Sara"}`, func(m *Message) bool { return m.Contact.PhoneNumber == "0912" && m.Contact.Name == "Sara" }},
+		{"join", MESSAGE_TYPE_JOIN, "", func(m *Message) bool { return m.Text == "/start" }},
+		{"leave", MESSAGE_TYPE_LEAVE, "", func(m *Message) bool { return m.Text == "/leave" }},
+		{"submit form", MESSAGE_TYPE_SUBMITFORM, `{"message_id":4,"callback_id":"cb","data":"?name=Sara&c=1&c=2"}`, func(m *Message) bool {
+			return m.FormData.Data["name"] == "Sara" && len(m.FormData.Values["c"]) == 2 && m.FormData.CallbackID == "cb"
+		}},
+		{"trigger button", MESSAGE_TYPE_TRIGGER_BUTTON, `{"message_id":5,"callback_id":"cb","data":"{\"state_path\":\"/menu\",\"params\":{\"a\":\"1\"}}"}`, func(m *Message) bool {
+			return m.MessageID == 5 && m.CallbackQuery.QueryActin.StatePath == "/menu" && m.CallbackQuery.QueryActin.Params["a"] == "1"
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			update, err := json.Marshal(map[string]interface{}{"type": tt.typ, "chat_id": "12", "data": tt.data})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := newTestCtx(&BotAPI{CallbackCodec: JSONCallbackCodec{}}, &Message{})
+			if err := ctx.Unmarshal(update); err != nil {
+				t.Fatal(err)
+			}
+			if ctx.Message.ChatID != 12 || !tt.check(ctx.Message) {
+				t.Errorf("Unmarshal(%s) = %+v", update, ctx.Message)
+			}
+			if string(ctx.Message.RawUpdate) != string(update) {
+				t.Errorf("RawUpdate = %s", ctx.Message.RawUpdate)
+			}
+		})
+	}
+}
+
+func TestUnmarshalUnknownType(t *testing.T) {
+	update := []byte(`{"type":"poll","chat_id":1,"data":"{\"question\":\"?\"}"}`)
+	tests := []struct {
+		name    string
+		strict  bool
+		handler bool
+		err     bool
+	}{
+		{name: "lenient"},
+		{name: "strict", strict: true, err: true},
+		{name: "strict with handler", strict: true, handler: true},
+		{name: "lenient with handler", handler: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, _ := recordingBot(t)
+			bot.StrictUpdates = tt.strict
+			var unknown, routed bool
+			if tt.handler {
+				bot.UnknownTypeHandler = func(ctx *Ctx) (Message, error) {
+					unknown = ctx.Message.Type == "poll" && string(ctx.Message.RawUpdate) == string(update)
+					return Message{}, nil
+				}
+			}
+			bot.DefaultHandler = func(ctx *Ctx) (Message, error) {
+				routed = true
+				return Message{}, nil
+			}
+			_, err := bot.HandleUpdates(update)
+			var unknownErr *UnknownUpdateError
+			if tt.err != errors.As(err, &unknownErr) {
+				t.Fatalf("HandleUpdates() = %v, want UnknownUpdateError %v", err, tt.err)
+			}
+			if unknown != tt.handler {
+				t.Errorf("UnknownTypeHandler ran: %v, want %v", unknown, tt.handler)
+			}
+			if want := !tt.handler && !tt.err; routed != want {
+				t.Errorf("routed to DefaultHandler: %v, want %v", routed, want)
+			}
+		})
+	}
+}
+
+// buttonUpdate is a press of a button routing to /menu, as Gap sends it.
+var buttonUpdate = []byte(`{"type":"triggerButton","chat_id":1,"from":{"id":42},"data":"{\"message_id\":5,\"callback_id\":\"cb\",\"data\":\"{\\\"state_path\\\":\\\"/menu\\\"}\"}"}`)
+
+func TestCtxAnswerCallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler Handler
+		answers []string
+	}{
+		{name: "unanswered", handler: func(ctx *Ctx) (Message, error) {
+			return Message{}, nil
+		}, answers: []string{" "}},
+		{name: "answer", handler: func(ctx *Ctx) (Message, error) {
+			if _, err := ctx.Answer("done"); err != nil {
+				return Message{}, err
+			}
+			if _, err := ctx.Alert("again"); !errors.Is(err, ErrCallbackAnswered) {
+				t.Errorf("second answer = %v, want ErrCallbackAnswered", err)
+			}
+			return Message{}, nil
+		}, answers: []string{"done "}},
+		{name: "alert", handler: func(ctx *Ctx) (Message, error) {
+			return ctx.Alert("sure?")
+		}, answers: []string{"sure? true"}},
+		{name: "answered through Send", handler: func(ctx *Ctx) (Message, error) {
+			return ctx.bot.Send(NewAnswerCallback(1, "cb", "sent", false))
+		}, answers: []string{"sent "}},
+		{name: "answered through MakeRequest", handler: func(ctx *Ctx) (Message, error) {
+			_, err := ctx.bot.MakeRequest("answerCallback", Params{"chat_id": "1", "callback_id": "cb", "text": "made"})
+			return Message{}, err
+		}, answers: []string{"made "}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, calls := recordingBot(t)
+			bot.Handle("/menu", tt.handler)
+			if _, err := bot.HandleUpdates(buttonUpdate); err != nil {
+				t.Fatal(err)
+			}
+			var answers []string
+			for _, call := range *calls {
+				if call.Get("method") != "answerCallback" || call.Get("callback_id") != "cb" {
+					t.Errorf("unexpected call %v", call)
+				}
+				answers = append(answers, call.Get("text")+" "+call.Get("show_alert"))
+			}
+			if fmt.Sprint(answers) != fmt.Sprint(tt.answers) {
+				t.Errorf("answers %q, want %q", answers, tt.answers)
+			}
+		})
+	}
+}
+
+func TestCtxAnswerCallbackFailure(t *testing.T) {
+	var answers []string
+	bot := newTestBot(t, func(w http.ResponseWriter, r *http.Request) {
+		answers = append(answers, r.FormValue("text"))
+		if len(answers) == 1 {
+			fmt.Fprint(w, `{"error":"unavailable"}`)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	})
+	bot.Handle("/menu", func(ctx *Ctx) (Message, error) {
+		if _, err := ctx.Answer("done"); err == nil {
+			t.Error("Answer() hid the error of Gap")
+		}
+		return Message{}, nil
+	})
+	if _, err := bot.HandleUpdates(buttonUpdate); err != nil {
+		t.Fatal(err)
+	}
+	// a failed answer does not count, so the press is still acknowledged
+	if fmt.Sprint(answers) != "[done ]" {
+		t.Errorf("answers %q, want the failed one and an acknowledgement", answers)
+	}
+}
+
+func TestCtxAnswerWithoutCallback(t *testing.T) {
+	bot, calls := recordingBot(t)
+	ctx := newTestCtx(bot, &Message{ChatID: 1, Type: MESSAGE_TYPE_TEXT, Text: "hi"})
+	if _, err := ctx.Answer("done"); err == nil {
+		t.Error("Answer() of a text message succeeded")
+	}
+	if _, err := ctx.EditCallbackMessage("edited", nil); err == nil {
+		t.Error("EditCallbackMessage() of a text message succeeded")
+	}
+	ctx.acknowledge()
+	if len(*calls) != 0 {
+		t.Errorf("%d calls made for a text message", len(*calls))
+	}
+}
+
+func TestCtxEditCallbackMessage(t *testing.T) {
+	bot, calls := recordingBot(t)
+	markup := NewInlineKeyboardMarkup(NewInlineKeyboardRow(InlineKeyboardButton{Text: "Back", CallbackData: "/"}))
+	bot.Handle("/menu", func(ctx *Ctx) (Message, error) {
+		return ctx.EditCallbackMessage("edited", markup)
+	})
+	if _, err := bot.HandleUpdates(buttonUpdate); err != nil {
+		t.Fatal(err)
+	}
+	if len(*calls) != 2 {
+		t.Fatalf("%d calls, want an edit and an acknowledgement", len(*calls))
+	}
+	edit := (*calls)[0]
+	keyboard, _ := json.Marshal(markup)
+	if edit.Get("method") != "editMessage" || edit.Get("chat_id") != "1" || edit.Get("message_id") != "5" || edit.Get("data") != "edited" || edit.Get("inline_keyboard") != string(keyboard) {
+		t.Errorf("edit sent as %v", edit)
+	}
+}
@@ -0,0 +1,476 @@
+package gapBotApi
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormErrors maps form object names to what is wrong with their submitted value.
+type FormErrors map[string]string
+
+func (e FormErrors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	messages := make([]string, len(names))
+	for i, name := range names {
+		messages[i] = name + " " + e[name]
+	}
+	return strings.Join(messages, "; ")
+}
+
+// formField is a struct field bound to a form object.
+type formField struct {
+	reflect.StructField
+	Name string
+}
+
+// formFields lists the fields of a struct that map to form objects. The form tag
+// names the form object and defaults to the field name; "-" skips the field.
+func formFields(t reflect.Type) []formField {
+	var fields []formField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for _, embedded := range formFields(field.Type) {
+				embedded.Index = append([]int{i}, embedded.Index...)
+				fields = append(fields, embedded)
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Tag.Get("form")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, formField{StructField: field, Name: name})
+	}
+	return fields
+}
+
+// BindForm decodes the submitted form of the update into the struct pointed to by v.
+//
+// Fields are matched to form objects by their form tag and may be strings, bools,
+// numbers, time.Time (parsed with the layout tag, "2006-01-02" by default) or slices
+// of those for multi-selects. The validate tag takes a comma separated list of
+// required, min=N and max=N, where min and max bound numbers, the length of strings
+// and the number of slice items; the pattern tag holds a regular expression strings
+// must match. Invalid values are reported together as FormErrors.
+func (ctx *Ctx) BindForm(v interface{}) error {
+	if ctx.Message.Type != MESSAGE_TYPE_SUBMITFORM {
+		return fmt.Errorf("%s update has no form data", ctx.Message.Type)
+	}
+	values := ctx.Message.FormData.Values
+	if values == nil {
+		values = make(map[string][]string)
+		for key, value := range ctx.Message.FormData.Data {
+			values[key] = []string{value}
+		}
+	}
+	return bindForm(values, v)
+}
+
+func bindForm(values map[string][]string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("BindForm needs a pointer to a struct")
+	}
+	rv = rv.Elem()
+
+	errs := make(FormErrors)
+	for _, field := range formFields(rv.Type()) {
+		raw := nonEmpty(values[field.Name])
+		target := rv.FieldByIndex(field.Index)
+		if target.Kind() == reflect.Slice && len(raw) == 1 {
+			raw = nonEmpty(strings.Split(raw[0], ","))
+		}
+
+		rules := parseFormRules(field.Tag.Get("validate"))
+		if len(raw) == 0 {
+			if rules.required {
+				errs[field.Name] = "is required"
+			}
+			continue
+		}
+		if msg := setFormValue(target, raw, field.Tag.Get("layout")); msg != "" {
+			errs[field.Name] = msg
+			continue
+		}
+		if msg := rules.check(target, field.Tag.Get("pattern")); msg != "" {
+			errs[field.Name] = msg
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func nonEmpty(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// setFormValue converts raw into the type of target and returns what is wrong with it, if anything.
+func setFormValue(target reflect.Value, raw []string, layout string) string {
+	if target.Kind() == reflect.Slice && target.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(target.Type(), len(raw), len(raw))
+		for i, value := range raw {
+			if msg := setFormScalar(slice.Index(i), value, layout); msg != "" {
+				return msg
+			}
+		}
+		target.Set(slice)
+		return ""
+	}
+	return setFormScalar(target, raw[0], layout)
+}
+
+func setFormScalar(target reflect.Value, value, layout string) string {
+	if target.Type() == timeType {
+		if layout == "" {
+			layout = "2006-01-02"
+		}
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			return "must be a date like " + layout
+		}
+		target.Set(reflect.ValueOf(t))
+		return ""
+	}
+
+	switch target.Kind() {
+	case reflect.String:
+		target.SetString(value)
+	case reflect.Bool:
+		switch strings.ToLower(value) {
+		case "on", "yes", "checked":
+			target.SetBool(true)
+		case "off", "no":
+			target.SetBool(false)
+		default:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return "must be yes or no"
+			}
+			target.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, target.Type().Bits())
+		if err != nil {
+			return "must be a whole number"
+		}
+		target.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, target.Type().Bits())
+		if err != nil {
+			return "must be a positive whole number"
+		}
+		target.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, target.Type().Bits())
+		if err != nil {
+			return "must be a number"
+		}
+		target.SetFloat(n)
+	default:
+		return "has unsupported type " + target.Type().String()
+	}
+	return ""
+}
+
+type formRules struct {
+	required bool
+	min, max *float64
+}
+
+func parseFormRules(tag string) formRules {
+	var rules formRules
+	for _, rule := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch key {
+		case "required":
+			rules.required = true
+		case "min", "max":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			if key == "min" {
+				rules.min = &n
+			} else {
+				rules.max = &n
+			}
+		}
+	}
+	return rules
+}
+
+func (rules formRules) check(target reflect.Value, pattern string) string {
+	var size float64
+	unit := ""
+	switch target.Kind() {
+	case reflect.String:
+		size, unit = float64(len([]rune(target.String()))), " characters"
+	case reflect.Slice:
+		size, unit = float64(target.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(target.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(target.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = target.Float()
+	}
+	if rules.min != nil && size < *rules.min {
+		return "must be at least " + strconv.FormatFloat(*rules.min, 'f', -1, 64) + unit
+	}
+	if rules.max != nil && size > *rules.max {
+		return "must be at most " + strconv.FormatFloat(*rules.max, 'f', -1, 64) + unit
+	}
+
+	if pattern == "" {
+		return ""
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "has an invalid pattern"
+	}
+	var texts []string
+	switch {
+	case target.Kind() == reflect.String:
+		texts = []string{target.String()}
+	case target.Kind() == reflect.Slice && target.Type().Elem().Kind() == reflect.String:
+		for i := 0; i < target.Len(); i++ {
+			texts = append(texts, target.Index(i).String())
+		}
+	}
+	for _, text := range texts {
+		if !re.MatchString(text) {
+			return "has an invalid format"
+		}
+	}
+	return ""
+}
+
+// Validate checks that a form can be rendered by Gap: every object has a known type
+// and a unique name, radios and selects have options, inbuilt objects name their
+// scanner and the form has a submit button. Forms are validated before sending
+// unless the config sets SkipFormValidation.
+func (form Form) Validate() error {
+	var errs []error
+	names := make(map[string]bool)
+	hasSubmit := false
+	for i, object := range form {
+		switch {
+		case object.Name == "":
+			errs = append(errs, fmt.Errorf("form object %d has no name", i))
+		case names[object.Name]:
+			errs = append(errs, fmt.Errorf("form object name %q is not unique", object.Name))
+		}
+		names[object.Name] = true
+
+		switch {
+		case !object.Type.IsKnown():
+			errs = append(errs, fmt.Errorf("form object %q has unknown type %q", object.Name, object.Type))
+		case object.Type.HasOptions() && len(object.Options) == 0:
+			errs = append(errs, fmt.Errorf("%s form object %q has no options", object.Type, object.Name))
+		case object.Type == FORM_OBJECTS_TYPE_INBUILT && object.Value != "barcode" && object.Value != "qrcode":
+			errs = append(errs, fmt.Errorf("inbuilt form object %q must be a barcode or qrcode", object.Name))
+		case object.Type == FORM_OBJECTS_TYPE_SUBMIT:
+			hasSubmit = true
+		}
+	}
+	if !hasSubmit {
+		errs = append(errs, errors.New("form has no submit button"))
+	}
+	return errors.Join(errs...)
+}
+
+// validateForm checks form before it is sent unless skip is set.
+func validateForm(form Form, skip bool) error {
+	if skip {
+		return nil
+	}
+	if err := form.Validate(); err != nil {
+		return fmt.Errorf("invalid form: %w", err)
+	}
+	return nil
+}
+
+// FillForm returns a copy of form with the previously submitted values filled in and
+// the errors appended to the labels of the objects they belong to, ready to be sent
+// back to the user.
+func FillForm(form Form, values map[string]string, errs FormErrors) Form {
+	filled := make(Form, len(form))
+	copy(filled, form)
+	for i, object := range filled {
+		switch object.Type {
+		case FORM_OBJECTS_TYPE_SUBMIT, FORM_OBJECTS_TYPE_INBUILT, FORM_OBJECTS_TYPE_FILE:
+		default:
+			if value, ok := values[object.Name]; ok {
+				filled[i].Value = value
+			}
+		}
+		if msg, ok := errs[object.Name]; ok {
+			filled[i].Label = fmt.Sprintf("%s (%s)", object.Label, msg)
+		}
+	}
+	return filled
+}
+
+// ResendForm sends form again to the update's chat with the values the user just
+// submitted and, when err is FormErrors returned by BindForm, the error messages.
+func (ctx *Ctx) ResendForm(text string, form Form, err error) (Message, error) {
+	var errs FormErrors
+	errors.As(err, &errs)
+	msg := NewMessage(ctx.Message.ChatID, text)
+	values := ctx.Message.FormData.Data
+	if ctx.Message.FormData.Values != nil {
+		// every choice of a multi-select, in the format BindForm reads
+		values = make(map[string]string, len(ctx.Message.FormData.Values))
+		for name, list := range ctx.Message.FormData.Values {
+			values[name] = strings.Join(list, ",")
+		}
+	}
+	msg.Form = FillForm(form, values, errs)
+	return ctx.send(msg)
+}
+
+// FormSubmitName is the name of the submit button NewFormFromStruct adds.
+const FormSubmitName = "submit"
+
+// NewFormFromStruct builds a form from a struct, so that the same struct can later
+// receive the submission through Ctx.BindForm.
+//
+// Each field bound by its form tag becomes one form object. The label tag sets the
+// label and defaults to the form object name. The type tag picks the FORM_OBJECTS_TYPE,
+// or "barcode" and "qrcode" for the inbuilt scanners; without it the type follows the
+// field: bools become checkboxes, numbers number inputs, time.Time date inputs, fields
+// with options selects or, for slices, multi-selects, and everything else text
+// inputs. The options tag lists the choices of radios and selects as
+// "value=Label|value=Label". Non-zero field values of v are used as the default
+// values, and a submit button named FormSubmitName and labelled submit closes the
+// form, so no field may be bound to that name.
+func NewFormFromStruct(v interface{}, submit string) (Form, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, errors.New("NewFormFromStruct needs a struct")
+	}
+
+	var form Form
+	for _, field := range formFields(rv.Type()) {
+		if field.Name == FormSubmitName {
+			return nil, fmt.Errorf("field %s is bound to %q, the name of the submit button", field.StructField.Name, FormSubmitName)
+		}
+		label := field.Tag.Get("label")
+		if label == "" {
+			label = field.Name
+		}
+		object := FormObject{
+			Name:    field.Name,
+			Label:   label,
+			Type:    FORM_OBJECTS_TYPE(field.Tag.Get("type")),
+			Options: parseFormOptions(field.Tag.Get("options")),
+		}
+		switch object.Type {
+		case "barcode", "qrcode":
+			object.Value = string(object.Type)
+			object.Type = FORM_OBJECTS_TYPE_INBUILT
+		case "":
+			object.Type = inferFormType(field.Type, len(object.Options) > 0)
+		}
+		if object.Type != FORM_OBJECTS_TYPE_INBUILT {
+			object.Value = formValueString(rv.FieldByIndex(field.Index), field.Tag.Get("layout"))
+		}
+		form = append(form, object)
+	}
+
+	if submit == "" {
+		submit = "Submit"
+	}
+	return append(form, NewFormObjectSubmit(FormSubmitName, submit)), nil
+}
+
+// inferFormType picks the form object type for a field without a type tag.
+func inferFormType(t reflect.Type, hasOptions bool) FORM_OBJECTS_TYPE {
+	if t == timeType {
+		return FORM_OBJECTS_TYPE_DATE
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return FORM_OBJECTS_TYPE_CHECKBOX
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if !hasOptions {
+			return FORM_OBJECTS_TYPE_NUMBER
+		}
+	case reflect.Slice:
+		if hasOptions {
+			return FORM_OBJECTS_TYPE_MULTISELECT
+		}
+	}
+	if hasOptions {
+		return FORM_OBJECTS_TYPE_SELECT
+	}
+	return FORM_OBJECTS_TYPE_TEXT
+}
+
+func parseFormOptions(tag string) []FormObjectOption {
+	if tag == "" {
+		return nil
+	}
+	var options []FormObjectOption
+	for _, option := range strings.Split(tag, "|") {
+		value, label, ok := strings.Cut(option, "=")
+		if !ok {
+			label = value
+		}
+		options = append(options, FormObjectOption{value: label})
+	}
+	return options
+}
+
+// formValueString formats a field value as a form default, leaving zero values empty.
+func formValueString(value reflect.Value, layout string) string {
+	if value.IsZero() {
+		return ""
+	}
+	if t, ok := value.Interface().(time.Time); ok {
+		if layout == "" {
+			layout = "2006-01-02"
+		}
+		return t.Format(layout)
+	}
+	if value.Kind() == reflect.Slice {
+		items := make([]string, value.Len())
+		for i := range items {
+			items[i] = fmt.Sprint(value.Index(i).Interface())
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value.Interface())
+}
@@ -0,0 +1,299 @@
+package gapBotApi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+type bindFormTarget struct {
+	Name     string    `form:"name" validate:"required,min=2,max=10"`
+	Age      int       `form:"age" validate:"min=18,max=120"`
+	Weight   float64   `form:"weight"`
+	Count    uint8     `form:"count"`
+	Agree    bool      `form:"agree"`
+	Birthday time.Time `form:"birthday"`
+	Meeting  time.Time `form:"meeting" layout:"2006/01/02 15:04"`
+	Colors   []string  `form:"colors" validate:"max=2"`
+	Sizes    []int     `form:"sizes"`
+	Code     string    `form:"code" pattern:"^[A-Z]{3}$"`
+	Tags     []string  `form:"tags" pattern:"^[a-z]+$"`
+	Skipped  string    `form:"-"`
+	Plain    string
+	hidden   string
+}
+
+func TestBindForm(t *testing.T) {
+	tests := []struct {
+		name   string
+		values url.Values
+		want   bindFormTarget
+		errs   FormErrors
+	}{
+		{
+			name:   "all fields",
+			values: url.Values{"name": {"Sara"}, "age": {"30"}, "weight": {"61.5"}, "count": {"3"}, "agree": {"on"}, "birthday": {"1994-02-03"}, "meeting": {"2024/05/06 07:08"}, "colors": {"red", "blue"}, "sizes": {"1", "2"}, "code": {"ABC"}, "tags": {"a", "b"}, "Skipped": {"x"}, "Plain": {"p"}},
+			want: bindFormTarget{
+				Name: "Sara", Age: 30, Weight: 61.5, Count: 3, Agree: true,
+				Birthday: time.Date(1994, 2, 3, 0, 0, 0, 0, time.UTC),
+				Meeting:  time.Date(2024, 5, 6, 7, 8, 0, 0, time.UTC),
+				Colors:   []string{"red", "blue"}, Sizes: []int{1, 2}, Code: "ABC", Tags: []string{"a", "b"}, Plain: "p",
+			},
+		},
+		{
+			name:   "multi-select joined with commas",
+			values: url.Values{"name": {"Sara"}, "colors": {"red, blue"}, "sizes": {"1,2,"}},
+			want:   bindFormTarget{Name: "Sara", Colors: []string{"red", "blue"}, Sizes: []int{1, 2}},
+		},
+		{
+			name:   "blank values are missing",
+			values: url.Values{"name": {"  "}, "age": {""}},
+			errs:   FormErrors{"name": "is required"},
+		},
+		{
+			name:   "bool spellings",
+			values: url.Values{"name": {"Sara"}, "agree": {"YES"}},
+			want:   bindFormTarget{Name: "Sara", Agree: true},
+		},
+		{
+			name:   "bool off",
+			values: url.Values{"name": {"Sara"}, "agree": {"off"}},
+			want:   bindFormTarget{Name: "Sara"},
+		},
+		{
+			name: "invalid values",
+			values: url.Values{"name": {"S"}, "age": {"old"}, "weight": {"heavy"}, "count": {"-1"}, "agree": {"maybe"},
+				"birthday": {"03/02/1994"}, "colors": {"red", "blue", "green"}, "sizes": {"1", "x"}, "code": {"abc"}, "tags": {"a", "B"}},
+			errs: FormErrors{
+				"name":     "must be at least 2 characters",
+				"age":      "must be a whole number",
+				"weight":   "must be a number",
+				"count":    "must be a positive whole number",
+				"agree":    "must be yes or no",
+				"birthday": "must be a date like 2006-01-02",
+				"colors":   "must be at most 2 items",
+				"sizes":    "must be a whole number",
+				"code":     "has an invalid format",
+				"tags":     "has an invalid format",
+			},
+		},
+		{
+			name:   "out of range",
+			values: url.Values{"name": {"Sara Sara Sara"}, "age": {"17"}, "count": {"300"}},
+			errs: FormErrors{
+				"name":  "must be at most 10 characters",
+				"age":   "must be at least 18",
+				"count": "must be a positive whole number",
+			},
+		},
+		{
+			name:   "length counts characters",
+			values: url.Values{"name": {"سارا"}},
+			want:   bindFormTarget{Name: "سارا"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got bindFormTarget
+			err := bindForm(tt.values, &got)
+			if tt.errs == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("bindForm = %+v, want %+v", got, tt.want)
+				}
+				return
+			}
+			var errs FormErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("bindForm error = %v, want FormErrors", err)
+			}
+			if !reflect.DeepEqual(errs, tt.errs) {
+				t.Errorf("bindForm errors = %v, want %v", errs, tt.errs)
+			}
+		})
+	}
+}
+
+func TestBindFormTarget(t *testing.T) {
+	var s bindFormTarget
+	for _, v := range []interface{}{s, nil, new(int), (*bindFormTarget)(nil)} {
+		if err := bindForm(url.Values{}, v); err == nil {
+			t.Errorf("bindForm(%T) succeeded", v)
+		}
+	}
+
+	ctx := &Ctx{Message: &Message{Type: MESSAGE_TYPE_TEXT}}
+	if err := ctx.BindForm(&s); err == nil {
+		t.Error("BindForm of a text update succeeded")
+	}
+}
+
+func TestBindFormEmbedded(t *testing.T) {
+	type Address struct {
+		City string `form:"city"`
+	}
+	var got struct {
+		Address
+		Name string `form:"name"`
+	}
+	if err := bindForm(url.Values{"city": {"Tabriz"}, "name": {"Sara"}}, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.City != "Tabriz" || got.Name != "Sara" {
+		t.Errorf("bindForm = %+v", got)
+	}
+}
+
+func TestResendFormKeepsMultiSelect(t *testing.T) {
+	var sent Form
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.Unmarshal([]byte(r.FormValue("form")), &sent); err != nil {
+			t.Error(err)
+		}
+		w.Write([]byte(`{"id":1}`))
+	}))
+	defer srv.Close()
+	bot, err := NewBotAPIWithClient("token", srv.URL+"/%s", resty.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	update, err := json.Marshal(map[string]interface{}{
+		"type":    MESSAGE_TYPE_SUBMITFORM,
+		"chat_id": 1,
+		"data":    `{"message_id":2,"callback_id":"cb","data":"?name=S&colors=red&colors=blue"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &Ctx{bot: bot, Message: &Message{}}
+	if err := ctx.Unmarshal(update); err != nil {
+		t.Fatal(err)
+	}
+	colors := []FormObjectOption{{"red": "Red"}, {"blue": "Blue"}, {"green": "Green"}}
+	form := Form{
+		{Name: "name", Type: FORM_OBJECTS_TYPE_TEXT, Label: "Name"},
+		{Name: "colors", Type: FORM_OBJECTS_TYPE_MULTISELECT, Label: "Colors", Options: colors},
+		NewFormObjectSubmit("submit", "Send"),
+	}
+	if _, err := ctx.ResendForm("again", form, FormErrors{"name": "is too short"}); err != nil {
+		t.Fatal(err)
+	}
+	want := Form{
+		{Name: "name", Type: FORM_OBJECTS_TYPE_TEXT, Label: "Name (is too short)", Value: "S"},
+		{Name: "colors", Type: FORM_OBJECTS_TYPE_MULTISELECT, Label: "Colors", Value: "red,blue", Options: colors},
+		NewFormObjectSubmit("submit", "Send"),
+	}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("resent form = %+v, want %+v", sent, want)
+	}
+}
+
+func TestNewFormFromStructRoundTrip(t *testing.T) {
+	in := bindFormTarget{
+		Name: "Sara", Age: 30, Agree: true,
+		Birthday: time.Date(1994, 2, 3, 0, 0, 0, 0, time.UTC),
+		Meeting:  time.Date(2024, 5, 6, 7, 8, 0, 0, time.UTC),
+		Colors:   []string{"red", "blue"}, Sizes: []int{1, 2}, Code: "ABC",
+	}
+	form, err := NewFormFromStruct(in, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := form[len(form)-1]; !reflect.DeepEqual(last, NewFormObjectSubmit(FormSubmitName, "Submit")) {
+		t.Errorf("form ends with %+v, want the submit button", last)
+	}
+	values := url.Values{}
+	for _, object := range form {
+		if object.Type != FORM_OBJECTS_TYPE_SUBMIT && object.Value != "" {
+			values.Set(object.Name, object.Value)
+		}
+	}
+	var out bindFormTarget
+	if err := bindForm(values, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("bindForm(NewFormFromStruct(%+v)) = %+v", in, out)
+	}
+}
+
+func TestNewFormFromStructSubmitName(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		fail bool
+	}{
+		{name: "field named submit", v: struct{ Submit string }{}},
+		{name: "tag named submit", v: struct {
+			Send string `form:"submit"`
+		}{}, fail: true},
+		{name: "embedded tag named submit", v: struct {
+			bindFormTarget
+			Send bool `form:"submit"`
+		}{}, fail: true},
+		{name: "skipped", v: struct {
+			Send string `form:"-"`
+		}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFormFromStruct(tt.v, "Send")
+			if (err != nil) != tt.fail {
+				t.Errorf("NewFormFromStruct() = %v, want error %v", err, tt.fail)
+			}
+		})
+	}
+}
+
+func TestFormValidate(t *testing.T) {
+	submit := NewFormObjectSubmit("send", "Send")
+	options := []FormObjectOption{{"a": "A"}}
+	tests := []struct {
+		name string
+		form Form
+		fail bool
+	}{
+		{name: "valid", form: NewForm(NewFormObjectInput("name", "Name"), NewFormObjectSelect("s", "S", options), NewFormObjectQrcode("q", "Q"), submit)},
+		{name: "no submit", form: NewForm(NewFormObjectInput("name", "Name")), fail: true},
+		{name: "no name", form: NewForm(NewFormObjectInput("", "Name"), submit), fail: true},
+		{name: "duplicate name", form: NewForm(NewFormObjectInput("a", "A"), NewFormObjectEmail("a", "A"), submit), fail: true},
+		{name: "unknown type", form: NewForm(FormObject{Name: "a", Type: "slider"}, submit), fail: true},
+		{name: "select without options", form: NewForm(NewFormObjectMultiSelect("m", "M", nil), submit), fail: true},
+		{name: "inbuilt without scanner", form: NewForm(FormObject{Name: "i", Type: FORM_OBJECTS_TYPE_INBUILT}, submit), fail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.form.Validate(); (err != nil) != tt.fail {
+				t.Errorf("Validate() = %v, want error %v", err, tt.fail)
+			}
+		})
+	}
+}
+
+func TestSkipFormValidation(t *testing.T) {
+	// a form Gap used to receive before forms were validated
+	form := NewForm(NewFormObjectInput("name", "Name"), FormObject{Name: "rating", Type: "stars"})
+	for _, skip := range []bool{false, true} {
+		bot, calls := recordingBot(t)
+		_, sendErr := bot.Send(MessageConfig{BaseChat: BaseChat{ChatID: 1}, Text: "Rate us", Form: form, SkipFormValidation: skip})
+		edit := NewEditForm(1, 2, "Rate us", form)
+		edit.SkipFormValidation = skip
+		_, editErr := bot.Send(edit)
+		if (sendErr == nil) != skip || (editErr == nil) != skip {
+			t.Errorf("SkipFormValidation %v: Send() = %v, edit = %v", skip, sendErr, editErr)
+		}
+		if want := map[bool]int{false: 0, true: 2}[skip]; len(*calls) != want {
+			t.Errorf("SkipFormValidation %v: %d calls made, want %d", skip, len(*calls), want)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package gapBotApi
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"strconv"
 )
 
@@ -26,6 +28,54 @@ func NewUpdateMessage(chatID int64, messageID int64, text string) UpdateMessageC
 	}
 }
 
+// NewEditInlineKeyboard creates a request to replace the inline keyboard of a message.
+func NewEditInlineKeyboard(chatID int64, messageID int64, markup InlineKeyboardMarkup) EditInlineKeyboardConfig {
+	return EditInlineKeyboardConfig{
+		BaseChat: BaseChat{
+			ChatID:               chatID,
+			InlineKeyboardMarkup: markup,
+		},
+		MessageId: messageID,
+	}
+}
+
+// NewEditForm creates a request to replace the text and form of a message.
+func NewEditForm(chatID int64, messageID int64, text string, form Form) EditFormConfig {
+	return EditFormConfig{
+		BaseChat: BaseChat{
+			ChatID: chatID,
+		},
+		MessageId: messageID,
+		Text:      text,
+		Form:      form,
+	}
+}
+
+// NewEditCaption creates a request to replace the caption of a media message.
+func NewEditCaption(chatID int64, messageID int64, messageType MESSAGE_TYPE, file File, caption string) EditCaptionConfig {
+	return EditCaptionConfig{
+		BaseChat: BaseChat{
+			ChatID: chatID,
+		},
+		MessageId: messageID,
+		Type:      messageType,
+		File:      file,
+		Caption:   caption,
+	}
+}
+
+// NewEditMedia creates a request to replace the file of a media message.
+func NewEditMedia(chatID int64, messageID int64, messageType MESSAGE_TYPE, file RequestFileData) EditMediaConfig {
+	return EditMediaConfig{
+		BaseFile: BaseFile{
+			BaseChat: BaseChat{ChatID: chatID},
+			File:     file,
+		},
+		MessageId: messageID,
+		Type:      messageType,
+	}
+}
+
 // NewDeleteMessage creates a request to delete a messageHandler.
 func NewDeleteMessage(chatID int64, messageID int64) DeleteMessageConfig {
 	return DeleteMessageConfig{
@@ -36,10 +86,44 @@ func NewDeleteMessage(chatID int64, messageID int64) DeleteMessageConfig {
 	}
 }
 
-// NewKeyboardButton creates a regular keyboard button.
+// NewForward creates a request to forward a message to another chat.
+func NewForward(chatID int64, fromChatID int64, messageID int64) ForwardMessageConfig {
+	return ForwardMessageConfig{
+		BaseChat: BaseChat{
+			ChatID: chatID,
+		},
+		FromChatID: fromChatID,
+		MessageId:  messageID,
+	}
+}
+
+// NewPinMessage creates a request to pin a message in its chat.
+func NewPinMessage(chatID int64, messageID int64) PinMessageConfig {
+	return PinMessageConfig{
+		BaseChat: BaseChat{
+			ChatID: chatID,
+		},
+		MessageId: messageID,
+	}
+}
+
+// NewUnpinMessage creates a request to unpin a message in its chat.
+func NewUnpinMessage(chatID int64, messageID int64) UnpinMessageConfig {
+	return UnpinMessageConfig{
+		BaseChat: BaseChat{
+			ChatID: chatID,
+		},
+		MessageId: messageID,
+	}
+}
+
+// NewKeyboardButton creates a regular keyboard button showing text that sends value
+// when pressed. An empty value sends the text itself.
 func NewKeyboardButton(text string, value string) ReplyKeyboardButton {
 	return ReplyKeyboardButton{
-		value: text,
+		Text:  text,
+		Value: value,
+		Type:  REPLY_KEYBOARD_BUTTON_TYPE_TEXT,
 	}
 }
 func NewKeyboardButtonRow(buttons ...ReplyKeyboardButton) []ReplyKeyboardButton {
@@ -61,14 +145,30 @@ func NewReplyKeyboardMarkup(rows ...[]ReplyKeyboardButton) ReplyKeyboardMarkup {
 	}
 }
 
+// NewOneTimeReplyKeyboard creates a keyboard that is hidden after a button is pressed.
+func NewOneTimeReplyKeyboard(rows ...[]ReplyKeyboardButton) ReplyKeyboardMarkup {
+	markup := NewReplyKeyboardMarkup(rows...)
+	markup.OneTime = true
+	return markup
+}
+
+// NewRemoveKeyboard creates a message that removes the reply keyboard of a chat.
+func NewRemoveKeyboard(chatID int64, text string) MessageConfig {
+	msg := NewMessage(chatID, text)
+	msg.ReplyKeyboardMarkup = ReplyKeyboardRemove{Remove: true}
+	return msg
+}
+
 func NewKeyboardButtonLocation(text string) ReplyKeyboardButton {
 	return ReplyKeyboardButton{
-		"$location": text,
+		Text: text,
+		Type: REPLY_KEYBOARD_BUTTON_TYPE_LOCATION,
 	}
 }
 func NewKeyboardButtonContact(text string) ReplyKeyboardButton {
 	return ReplyKeyboardButton{
-		"$contact": text,
+		Text: text,
+		Type: REPLY_KEYBOARD_BUTTON_TYPE_CONTACT,
 	}
 }
 
@@ -99,18 +199,36 @@ func (ikm InlineKeyboardMarkup) AddButtonToEndRow(ikb InlineKeyboardButton) Inli
 	ikm[lastRowIndex] = lastRow
 	return ikm
 }
+
+// NewInlineKeyboardButton builds a button whose action is encoded with JSONCallbackCodec,
+// which cannot fail for an action of strings. Use BotAPI.NewInlineKeyboardButton or
+// NewInlineKeyboardButtonWithCodec for codecs that can.
 func NewInlineKeyboardButton(text string, callbackData CallbackQueryAction) InlineKeyboardButton {
-	var ikb = InlineKeyboardButton{
-		Text:         text,
-		CallbackData: "",
-	}
-	jsonData, err := json.Marshal(callbackData)
-	if err == nil {
-		ikb.CallbackData = string(jsonData)
+	ikb, err := NewInlineKeyboardButtonWithCodec(JSONCallbackCodec{}, text, callbackData)
+	if err != nil {
+		panic(fmt.Sprintf("encode callback data of button %q: %s", text, err))
 	}
 	return ikb
 }
 
+// NewInlineKeyboardButtonWithCodec builds a button whose action is encoded with codec.
+func NewInlineKeyboardButtonWithCodec(codec CallbackCodec, text string, callbackData CallbackQueryAction) (InlineKeyboardButton, error) {
+	data, err := codec.Encode(callbackData)
+	if err != nil {
+		return InlineKeyboardButton{}, err
+	}
+	return InlineKeyboardButton{
+		Text:         text,
+		CallbackData: data,
+	}, nil
+}
+
+// NewInlineKeyboardButton builds a button whose action is encoded with the bot's
+// CallbackCodec, so presses of it decode in HandleUpdates.
+func (bot *BotAPI) NewInlineKeyboardButton(text string, callbackData CallbackQueryAction) (InlineKeyboardButton, error) {
+	return NewInlineKeyboardButtonWithCodec(bot.callbackCodec(), text, callbackData)
+}
+
 func NewInlineKeyboardButtonURL(text, url string, openIn INLINE_KEYBOARD_URL_OPENIN) InlineKeyboardButton {
 	return InlineKeyboardButton{
 		Text:   text,
@@ -129,6 +247,17 @@ func NewInlineKeyboardButtonPayment(text string, amount int, currency INLINE_KEY
 	}
 }
 
+// NewInvoice creates an invoice for the given amount.
+func NewInvoice(chatID int64, amount int, currency INLINE_KEYBOARD_CURRENCY, refId, description string) InvoiceConfig {
+	return InvoiceConfig{
+		BaseChat:    BaseChat{ChatID: chatID},
+		Amount:      amount,
+		Currency:    currency,
+		RefId:       refId,
+		Description: description,
+	}
+}
+
 func NewFormObjectInput(name, label string, value ...string) FormObject {
 	val := ""
 	if len(value) != 0 {
@@ -209,8 +338,71 @@ func NewFormObjectSelect(name, label string, options []FormObjectOption) FormObj
 		Options: options,
 	}
 }
-func NewForm(formObject ...FormObject) []FormObject {
-	var form []FormObject
+func NewFormObjectNumber(name, label string, value ...string) FormObject {
+	val := ""
+	if len(value) != 0 {
+		val = value[0]
+	}
+	return FormObject{
+		Name:  name,
+		Label: label,
+		Value: val,
+		Type:  FORM_OBJECTS_TYPE_NUMBER,
+	}
+}
+func NewFormObjectDate(name, label string, value ...string) FormObject {
+	val := ""
+	if len(value) != 0 {
+		val = value[0]
+	}
+	return FormObject{
+		Name:  name,
+		Label: label,
+		Value: val,
+		Type:  FORM_OBJECTS_TYPE_DATE,
+	}
+}
+func NewFormObjectPhone(name, label string, value ...string) FormObject {
+	val := ""
+	if len(value) != 0 {
+		val = value[0]
+	}
+	return FormObject{
+		Name:  name,
+		Label: label,
+		Value: val,
+		Type:  FORM_OBJECTS_TYPE_PHONE,
+	}
+}
+func NewFormObjectEmail(name, label string, value ...string) FormObject {
+	val := ""
+	if len(value) != 0 {
+		val = value[0]
+	}
+	return FormObject{
+		Name:  name,
+		Label: label,
+		Value: val,
+		Type:  FORM_OBJECTS_TYPE_EMAIL,
+	}
+}
+func NewFormObjectFile(name, label string) FormObject {
+	return FormObject{
+		Name:  name,
+		Label: label,
+		Type:  FORM_OBJECTS_TYPE_FILE,
+	}
+}
+func NewFormObjectMultiSelect(name, label string, options []FormObjectOption) FormObject {
+	return FormObject{
+		Name:    name,
+		Label:   label,
+		Type:    FORM_OBJECTS_TYPE_MULTISELECT,
+		Options: options,
+	}
+}
+func NewForm(formObject ...FormObject) Form {
+	var form Form
 	form = append(form, formObject...)
 	return form
 }
@@ -233,6 +425,16 @@ func NewVideo(chatID int64, file RequestFileData) VideoConfig {
 	}
 }
 
+// NewVideoNote creates a round video message.
+func NewVideoNote(chatID int64, file RequestFileData) VideoNoteConfig {
+	return VideoNoteConfig{
+		BaseFile: BaseFile{
+			BaseChat: BaseChat{ChatID: chatID},
+			File:     file,
+		},
+	}
+}
+
 func NewVoice(chatID int64, file RequestFileData) VoiceConfig {
 	return VoiceConfig{
 		BaseFile: BaseFile{
@@ -260,6 +462,47 @@ func NewFile(chatID int64, file RequestFileData) FileConfig {
 	}
 }
 
+func NewSticker(chatID int64, file RequestFileData) StickerConfig {
+	return StickerConfig{
+		BaseFile: BaseFile{
+			BaseChat: BaseChat{ChatID: chatID},
+			File:     file,
+		},
+	}
+}
+
+// NewMediaGroup creates a group of media messages to send to a chat in order.
+func NewMediaGroup(chatID int64, items ...Fileable) MediaGroupConfig {
+	return MediaGroupConfig{
+		ChatID: chatID,
+		Items:  items,
+	}
+}
+
+func NewLocation(chatID int64, latitude, longitude float64) LocationConfig {
+	return LocationConfig{
+		BaseChat:  BaseChat{ChatID: chatID},
+		Latitude:  latitude,
+		Longitude: longitude,
+	}
+}
+
+func NewContact(chatID int64, phoneNumber, name string) ContactConfig {
+	return ContactConfig{
+		BaseChat:    BaseChat{ChatID: chatID},
+		PhoneNumber: phoneNumber,
+		Name:        name,
+	}
+}
+
+// NewChatAction creates a chat action, such as ChatTyping or ChatUploadPhoto.
+func NewChatAction(chatID int64, action string) ChatActionConfig {
+	return ChatActionConfig{
+		BaseChat: BaseChat{ChatID: chatID},
+		Action:   action,
+	}
+}
+
 func NewAnswerCallback(chatID int64, callbackId string, text string, showAlert bool) CallbackAnswerConfig {
 	return CallbackAnswerConfig{
 		BaseChat:   BaseChat{ChatID: chatID},
@@ -277,11 +520,16 @@ func (message *Message) UnmarshalJson(data []byte) error {
 			return err
 		}
 		if chatIDStr, ok := raw["chat_id"].(string); ok {
-			chatID, err := strconv.ParseInt(chatIDStr, 10, 64)
-			if err != nil {
-				return err
+			chatID, parseErr := strconv.ParseInt(chatIDStr, 10, 64)
+			if parseErr != nil {
+				return parseErr
 			}
 			message.ChatID = chatID
+			// the string chat_id is what failed to decode, the rest of the update is fine
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) && typeErr.Field == "chat_id" {
+				err = nil
+			}
 		}
 	}
 	if message.Data != "" {
@@ -289,3 +537,47 @@ func (message *Message) UnmarshalJson(data []byte) error {
 	}
 	return err
 }
+
+// sentMessage builds the message a successful request created from the params it
+// was sent with, so it can be edited or deleted later. Only sendMessage and
+// editMessage carry a message type and data; other methods use "type" for something else.
+func sentMessage(resp *APIResponse, method string, params Params) Message {
+	msg := Message{
+		MessageID: resp.MessageId,
+	}
+	if chatID, err := strconv.ParseInt(params.GetParam("chat_id"), 10, 64); err == nil {
+		msg.ChatID = chatID
+	}
+	if method != "sendMessage" && method != "editMessage" {
+		return msg
+	}
+	msg.Type = MESSAGE_TYPE(params.GetParam("type"))
+	msg.Data = params.GetParam("data")
+
+	var target interface{}
+	switch msg.Type {
+	case MESSAGE_TYPE_TEXT:
+		msg.Text = msg.Data
+	case MESSAGE_TYPE_IMAGE:
+		target = &msg.Photo
+	case MESSAGE_TYPE_VIDEO:
+		target = &msg.Video
+	case MESSAGE_TYPE_VOICE:
+		target = &msg.Voice
+	case MESSAGE_TYPE_AUDIO:
+		target = &msg.Audio
+	case MESSAGE_TYPE_FILE:
+		target = &msg.File
+	case MESSAGE_TYPE_STICKER:
+		target = &msg.Sticker
+	case MESSAGE_TYPE_LOCATION:
+		target = &msg.Location
+	case MESSAGE_TYPE_CONTACT:
+		target = &msg.Contact
+	}
+	if target != nil && msg.Data != "" {
+		// the data was encoded by this package, so it always decodes
+		_ = json.Unmarshal([]byte(msg.Data), target)
+	}
+	return msg
+}
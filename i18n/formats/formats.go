@@ -0,0 +1,23 @@
+// Package formats decodes i18n catalogs written in YAML or TOML. It is a module of
+// its own so that only the bots loading such catalogs depend on their parsers.
+package formats
+
+import (
+	"github.com/BurntSushi/toml"
+	"github.com/amirimatin/gapBotApi/v2/i18n"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// YAML decodes .yaml and .yml catalogs.
+	YAML i18n.Decoder = yaml.Unmarshal
+	// TOML decodes .toml catalogs.
+	TOML i18n.Decoder = toml.Unmarshal
+)
+
+// Register makes a bundle load .yaml, .yml and .toml catalogs.
+func Register(b *i18n.Bundle) {
+	b.RegisterDecoder(".yaml", YAML)
+	b.RegisterDecoder(".yml", YAML)
+	b.RegisterDecoder(".toml", TOML)
+}
@@ -0,0 +1,54 @@
+package formats
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/amirimatin/gapBotApi/v2/i18n"
+)
+
+func TestRegister(t *testing.T) {
+	catalogs := fstest.MapFS{
+		"en.yaml": {Data: []byte(`
+welcome: "Hello {{.Name}}"
+cart:
+  items:
+    one: "{{.Count}} item"
+    other: "{{.Count}} items"
+`)},
+		"fa.toml": {Data: []byte(`
+welcome = "سلام {{.Name}}"
+
+[cart.items]
+one = "{{.Count}} کالا"
+other = "{{.Count}} کالاها"
+`)},
+		"de.yml": {Data: []byte(`welcome: "Hallo {{.Name}}"`)},
+	}
+	b := i18n.NewBundle("en")
+	Register(b)
+	if err := b.LoadFS(catalogs, "."); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		locale string
+		count  int
+		want   string
+	}{
+		{"en", 1, "1 item"},
+		{"en", 2, "2 items"},
+		{"fa", 0, "0 کالا"},
+		{"fa", 2, "2 کالاها"},
+		{"de", 2, "2 items"},
+	}
+	for _, tt := range tests {
+		if got := b.N(tt.locale, "cart.items", tt.count, nil); got != tt.want {
+			t.Errorf("N(%s, %d) = %q, want %q", tt.locale, tt.count, got, tt.want)
+		}
+	}
+	for locale, want := range map[string]string{"en": "Hello Sara", "fa": "سلام Sara", "de": "Hallo Sara"} {
+		if got := b.T(locale, "welcome", map[string]any{"Name": "Sara"}); got != want {
+			t.Errorf("T(%s) = %q, want %q", locale, got, want)
+		}
+	}
+}
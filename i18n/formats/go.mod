@@ -0,0 +1,9 @@
+module github.com/amirimatin/gapBotApi/v2/i18n/formats
+
+go 1.23
+
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/amirimatin/gapBotApi/v2 v2.1.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,358 @@
+// Package i18n translates bot messages from per-locale catalogs. Catalogs are
+// JSON, YAML or TOML files named after their locale, such as fa.yaml or en.json,
+// whose values are text/template sources:
+//
+//	welcome: "Hello {{bold .Name}}"
+//	cart:
+//	  items:
+//	    one: "{{.Count}} item in your cart"
+//	    other: "{{.Count}} items in your cart"
+//
+// Nested keys are joined with dots ("cart.items"), and a map of plural
+// categories is a pluralized message.
+//
+// JSON catalogs are decoded out of the box. The YAML and TOML decoders live in the
+// separate module github.com/amirimatin/gapBotApi/v2/i18n/formats, so bots that do
+// not use them do not depend on their parsers; any other format can be added with
+// Bundle.RegisterDecoder.
+package i18n
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/amirimatin/gapBotApi/v2/hypertext"
+)
+
+var ErrMessageNotFound = errors.New("message not found")
+
+// Decoder decodes the content of a catalog file into v.
+type Decoder func(data []byte, v any) error
+
+// message is a translation, with one template per plural category for
+// pluralized messages and a single Other template otherwise.
+type message map[string]*template.Template
+
+// Bundle holds the catalogs of every locale. It is safe for concurrent use, so
+// catalogs can be reloaded while messages are translated.
+type Bundle struct {
+	// DefaultLocale is used when a message is missing from the requested locale.
+	DefaultLocale string
+	// mu guards the maps below
+	mu       sync.RWMutex
+	funcs    template.FuncMap
+	decoders map[string]Decoder
+	rules    map[string]PluralRule
+	catalogs map[string]map[string]message
+}
+
+func NewBundle(defaultLocale string) *Bundle {
+	return &Bundle{
+		DefaultLocale: defaultLocale,
+		funcs:         FuncMap(),
+		decoders: map[string]Decoder{
+			".json": json.Unmarshal,
+		},
+		rules:    defaultPluralRules(),
+		catalogs: make(map[string]map[string]message),
+	}
+}
+
+// FuncMap returns the hypertext formatting functions under the names templates use.
+func FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"bold":      hypertext.Bold,
+		"italic":    hypertext.Italic,
+		"underline": hypertext.UnderLine,
+		"strike":    hypertext.Specifies,
+		"code":      hypertext.InlineQuote,
+		"quote":     hypertext.Quote,
+		// the color comes first so text can be piped in: {{.Name | color "#ff0000"}}
+		"color":       func(hexColor, str string) string { return hypertext.Colorize(str, hexColor) },
+		"enter":       hypertext.Enter,
+		"doubleEnter": hypertext.DoubleEnter,
+		"tab":         hypertext.Tab,
+		"line":        hypertext.Line,
+		"doubleLine":  hypertext.DoubleLine,
+	}
+}
+
+// Funcs adds functions templates can use. Only catalogs loaded afterwards can use
+// them, so it is usually called before loading any.
+func (b *Bundle) Funcs(funcs template.FuncMap) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for name, fn := range funcs {
+		b.funcs[name] = fn
+	}
+}
+
+// RegisterDecoder sets the decoder of catalog files with the given extension, such as ".yaml".
+func (b *Bundle) RegisterDecoder(ext string, decoder Decoder) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.decoders[strings.ToLower(ext)] = decoder
+}
+
+func (b *Bundle) decoder(ext string) (Decoder, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	decoder, ok := b.decoders[strings.ToLower(ext)]
+	return decoder, ok
+}
+
+// RegisterPluralRule sets the plural rule of a language, such as "ar".
+func (b *Bundle) RegisterPluralRule(lang string, rule PluralRule) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rules[lang] = rule
+}
+
+// pluralRule returns the rule of a language, English when it has none.
+func (b *Bundle) pluralRule(lang string) PluralRule {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if rule, ok := b.rules[lang]; ok {
+		return rule
+	}
+	return English
+}
+
+// LoadFile loads a catalog file named after its locale.
+func (b *Bundle) LoadFile(name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	return b.load(name, data)
+}
+
+// LoadDir loads every catalog file of a directory.
+func (b *Bundle) LoadDir(dir string) error {
+	return b.LoadFS(os.DirFS(dir), ".")
+}
+
+// LoadFS loads every catalog file of a directory of fsys, such as an embed.FS.
+func (b *Bundle) LoadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if _, ok := b.decoder(path.Ext(entry.Name())); !ok {
+			continue
+		}
+		name := path.Join(dir, entry.Name())
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		if err := b.load(name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Bundle) load(name string, data []byte) error {
+	ext := strings.ToLower(path.Ext(name))
+	decode, ok := b.decoder(ext)
+	if !ok {
+		return fmt.Errorf("catalog %s: no decoder for %q files", name, ext)
+	}
+	var messages map[string]any
+	if err := decode(data, &messages); err != nil {
+		return fmt.Errorf("catalog %s: %w", name, err)
+	}
+	locale := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	if err := b.AddMessages(locale, messages); err != nil {
+		return fmt.Errorf("catalog %s: %w", name, err)
+	}
+	return nil
+}
+
+// AddMessages adds messages to the catalog of a locale, replacing messages with
+// the same key.
+func (b *Bundle) AddMessages(locale string, messages map[string]any) error {
+	parsed := make(map[string]message)
+	b.mu.RLock()
+	err := b.parse(parsed, "", messages)
+	b.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	catalog, ok := b.catalogs[locale]
+	if !ok {
+		catalog = make(map[string]message)
+		b.catalogs[locale] = catalog
+	}
+	for key, msg := range parsed {
+		catalog[key] = msg
+	}
+	return nil
+}
+
+func (b *Bundle) parse(into map[string]message, prefix string, values map[string]any) error {
+	for k, v := range values {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch v := v.(type) {
+		case string:
+			tmpl, err := b.parseTemplate(key, v)
+			if err != nil {
+				return err
+			}
+			into[key] = message{Other: tmpl}
+		case map[string]any:
+			if !isPlural(v) {
+				if err := b.parse(into, key, v); err != nil {
+					return err
+				}
+				continue
+			}
+			msg := make(message)
+			for category, text := range v {
+				s, ok := text.(string)
+				if !ok {
+					return fmt.Errorf("message %s.%s is not text", key, category)
+				}
+				tmpl, err := b.parseTemplate(key+"."+category, s)
+				if err != nil {
+					return err
+				}
+				msg[category] = tmpl
+			}
+			into[key] = msg
+		default:
+			return fmt.Errorf("message %s is not text", key)
+		}
+	}
+	return nil
+}
+
+func (b *Bundle) parseTemplate(key, text string) (*template.Template, error) {
+	tmpl, err := template.New(key).Funcs(b.funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("message %s: %w", key, err)
+	}
+	return tmpl, nil
+}
+
+// isPlural reports whether a map holds the plural forms of one message.
+func isPlural(values map[string]any) bool {
+	if _, ok := values[Other]; !ok {
+		return false
+	}
+	for k := range values {
+		if !pluralCategories[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// Locales returns the locales that have a catalog.
+func (b *Bundle) Locales() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	locales := make([]string, 0, len(b.catalogs))
+	for locale := range b.catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// lookup finds a message in the locale, its language or the default locale, in
+// that order, and returns it with the locale it was found in.
+func (b *Bundle) lookup(locale, key string) (message, string, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, l := range []string{locale, language(locale), b.DefaultLocale} {
+		if msg, ok := b.catalogs[l][key]; ok {
+			return msg, l, true
+		}
+	}
+	return nil, "", false
+}
+
+// Translate renders the message of a key in a locale. When count is not nil the
+// plural form for *count is chosen and, if data is nil or a map, it is available
+// to the template as .Count.
+func (b *Bundle) Translate(locale, key string, count *int, data any) (string, error) {
+	msg, found, ok := b.lookup(locale, key)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrMessageNotFound, key)
+	}
+
+	tmpl := msg[Other]
+	if count != nil {
+		if t, ok := msg[b.pluralRule(language(found))(*count)]; ok {
+			tmpl = t
+		}
+		// an explicit zero form wins over the language rule
+		if t, ok := msg[Zero]; ok && *count == 0 {
+			tmpl = t
+		}
+		data = withCount(data, *count)
+	}
+
+	out := &bytes.Buffer{}
+	if err := tmpl.Execute(out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func withCount(data any, count int) any {
+	switch d := data.(type) {
+	case nil:
+		return map[string]any{"Count": count}
+	case map[string]any:
+		withCount := make(map[string]any, len(d)+1)
+		for k, v := range d {
+			withCount[k] = v
+		}
+		if _, ok := withCount["Count"]; !ok {
+			withCount["Count"] = count
+		}
+		return withCount
+	}
+	return data
+}
+
+// T renders the message of a key in a locale, or returns the key when the
+// message is missing or fails to render.
+func (b *Bundle) T(locale, key string, data any) string {
+	text, err := b.Translate(locale, key, nil, data)
+	if err != nil {
+		return key
+	}
+	return text
+}
+
+// N is like T but picks the plural form for count.
+func (b *Bundle) N(locale, key string, count int, data any) string {
+	text, err := b.Translate(locale, key, &count, data)
+	if err != nil {
+		return key
+	}
+	return text
+}
@@ -0,0 +1,192 @@
+package i18n
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"text/template"
+
+	"github.com/amirimatin/gapBotApi/v2/hypertext"
+)
+
+var catalogs = fstest.MapFS{
+	"locales/en.json": {Data: []byte(`{
+		"welcome": "Hello {{bold .Name}}",
+		"only_en": "English only",
+		"cart": {"items": {"one": "{{.Count}} item", "other": "{{.Count}} items"}},
+		"inbox": {"zero": "No messages", "one": "One message", "other": "{{.Count}} messages"}
+	}`)},
+	"locales/fa.json": {Data: []byte(`{
+		"welcome": "سلام {{.Name}}",
+		"cart": {"items": {"one": "{{.Count}} کالا", "other": "{{.Count}} کالاها"}}
+	}`)},
+	"locales/README.md": {Data: []byte("not a catalog")},
+}
+
+func newTestBundle(t *testing.T) *Bundle {
+	t.Helper()
+	b := NewBundle("en")
+	if err := b.LoadFS(catalogs, "locales"); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestBundleTranslate(t *testing.T) {
+	b := newTestBundle(t)
+	if got := fmt.Sprint(b.Locales()); got != "[en fa]" {
+		t.Errorf("Locales() = %s, want [en fa]", got)
+	}
+	tests := []struct {
+		name   string
+		locale string
+		key    string
+		want   string
+	}{
+		{name: "hypertext function", locale: "en", key: "welcome", want: "Hello " + hypertext.Bold("Sara")},
+		{name: "persian", locale: "fa", key: "welcome", want: "سلام Sara"},
+		{name: "region falls back to language", locale: "fa-IR", key: "welcome", want: "سلام Sara"},
+		{name: "falls back to default locale", locale: "fa", key: "only_en", want: "English only"},
+		{name: "unknown locale", locale: "de", key: "only_en", want: "English only"},
+		{name: "missing message", locale: "fa", key: "missing", want: "missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := b.T(tt.locale, tt.key, map[string]any{"Name": "Sara"}); got != tt.want {
+				t.Errorf("T(%s, %s) = %q, want %q", tt.locale, tt.key, got, tt.want)
+			}
+		})
+	}
+	if _, err := b.Translate("en", "missing", nil, nil); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("Translate() of a missing message = %v, want ErrMessageNotFound", err)
+	}
+}
+
+func TestBundlePlural(t *testing.T) {
+	b := newTestBundle(t)
+	tests := []struct {
+		locale string
+		key    string
+		count  int
+		want   string
+	}{
+		{"en", "cart.items", 0, "0 items"},
+		{"en", "cart.items", 1, "1 item"},
+		{"en", "cart.items", 2, "2 items"},
+		{"fa", "cart.items", 0, "0 کالا"},
+		{"fa", "cart.items", 1, "1 کالا"},
+		{"fa", "cart.items", 5, "5 کالاها"},
+		// the explicit zero form wins over the language rule
+		{"en", "inbox", 0, "No messages"},
+		{"en", "inbox", 1, "One message"},
+		{"en", "inbox", 3, "3 messages"},
+		// the rule is the one of the locale the message was found in
+		{"fa", "inbox", 0, "No messages"},
+		{"fa", "inbox", 3, "3 messages"},
+	}
+	for _, tt := range tests {
+		if got := b.N(tt.locale, tt.key, tt.count, nil); got != tt.want {
+			t.Errorf("N(%s, %s, %d) = %q, want %q", tt.locale, tt.key, tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestPluralRules(t *testing.T) {
+	for n, want := range map[int]string{0: Other, 1: One, 2: Other, 21: Other} {
+		if got := English(n); got != want {
+			t.Errorf("English(%d) = %s, want %s", n, got, want)
+		}
+	}
+	for n, want := range map[int]string{0: One, 1: One, 2: Other, 21: Other} {
+		if got := Persian(n); got != want {
+			t.Errorf("Persian(%d) = %s, want %s", n, got, want)
+		}
+	}
+
+	b := NewBundle("en")
+	if err := b.AddMessages("ar", map[string]any{"n": map[string]any{"two": "two", "other": "other"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.N("ar", "n", 2, nil); got != "other" {
+		t.Errorf("N() without an Arabic rule = %q, want the English rule", got)
+	}
+	b.RegisterPluralRule("ar", func(n int) string {
+		if n == 2 {
+			return Two
+		}
+		return Other
+	})
+	if got := b.N("ar", "n", 2, nil); got != "two" {
+		t.Errorf("N() with an Arabic rule = %q, want two", got)
+	}
+}
+
+func TestBundleLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data string
+	}{
+		{name: "invalid json", file: "en.json", data: `{"a":`},
+		{name: "invalid template", file: "en.json", data: `{"a": "{{.Name"}`},
+		{name: "not text", file: "en.json", data: `{"a": 1}`},
+		{name: "plural form not text", file: "en.json", data: `{"a": {"one": "x", "other": 2}}`},
+		{name: "no decoder", file: "en.yaml", data: `a: b`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBundle("en")
+			fsys := fstest.MapFS{tt.file: {Data: []byte(tt.data)}}
+			if err := b.load(tt.file, fsys[tt.file].Data); err == nil {
+				t.Error("load() succeeded")
+			}
+		})
+	}
+}
+
+func TestBundleFuncsAndDecoders(t *testing.T) {
+	b := NewBundle("en")
+	b.Funcs(template.FuncMap{"upper": strings.ToUpper})
+	b.RegisterDecoder(".TXT", func(data []byte, v any) error {
+		key, value, _ := strings.Cut(string(data), "=")
+		*v.(*map[string]any) = map[string]any{key: value}
+		return nil
+	})
+	if err := b.LoadFS(fstest.MapFS{"en.txt": {Data: []byte(`shout={{upper .}}`)}}, "."); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.T("en", "shout", "hi"); got != "HI" {
+		t.Errorf("T() = %q, want HI", got)
+	}
+}
+
+func TestBundleConcurrentUse(t *testing.T) {
+	b := newTestBundle(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				b.N("fa", "cart.items", j, nil)
+				b.T("en", "welcome", map[string]any{"Name": "Sara"})
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				b.Funcs(template.FuncMap{fmt.Sprintf("f%d", i): strings.ToUpper})
+				b.RegisterPluralRule("fa", Persian)
+				b.RegisterDecoder(".json", json.Unmarshal)
+				if err := b.LoadFS(catalogs, "locales"); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,50 @@
+package i18n
+
+import "strings"
+
+// Plural categories, as named by CLDR.
+const (
+	Zero  = "zero"
+	One   = "one"
+	Two   = "two"
+	Few   = "few"
+	Many  = "many"
+	Other = "other"
+)
+
+// PluralRule returns the plural category of a count in a language.
+type PluralRule func(n int) string
+
+var pluralCategories = map[string]bool{Zero: true, One: true, Two: true, Few: true, Many: true, Other: true}
+
+// English is the plural rule of English: 1 is one, everything else is other.
+func English(n int) string {
+	if n == 1 {
+		return One
+	}
+	return Other
+}
+
+// Persian is the plural rule of Persian as defined by CLDR: 0 and 1 are one,
+// everything else is other.
+func Persian(n int) string {
+	if n == 0 || n == 1 {
+		return One
+	}
+	return Other
+}
+
+func defaultPluralRules() map[string]PluralRule {
+	return map[string]PluralRule{
+		"en": English,
+		"fa": Persian,
+	}
+}
+
+// language returns the language part of a locale such as "fa-IR" or "en_US".
+func language(locale string) string {
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		return locale[:i]
+	}
+	return locale
+}
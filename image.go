@@ -0,0 +1,247 @@
+package gapBotApi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+const defaultJPEGQuality = 85
+
+// DefaultMaxImagePixels is the largest photo, in pixels, decoded for processing.
+// Decoding takes 4 bytes per pixel.
+const DefaultMaxImagePixels = 40_000_000
+
+// DefaultMaxImageSize is the most bytes of a photo read for processing when neither
+// RequestFile.MaxSize nor the MESSAGE_TYPE_FILE rule limits it.
+const DefaultMaxImageSize = 50 << 20
+
+// imageOptions returns the preprocessing options that apply to an upload, if any.
+func (bot *BotAPI) imageOptions(file RequestFile) *ImageOptions {
+	if file.Type != MESSAGE_TYPE_IMAGE {
+		return nil
+	}
+	if file.Image != nil {
+		return file.Image
+	}
+	return bot.ImageOptions
+}
+
+// processImage downscales and re-encodes a JPEG or PNG photo according to opts and
+// returns the new content along with its dimensions. Content that cannot be decoded,
+// GIFs which would lose their animation and WebP photos are returned unchanged,
+// metadata included, even when opts.StripMetadata is set.
+func processImage(data []byte, opts ImageOptions) ([]byte, image.Point, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return data, image.Point{}, nil
+	}
+	size := image.Pt(cfg.Width, cfg.Height)
+	if format != "jpeg" && format != "png" {
+		return data, size, nil
+	}
+	maxPixels := opts.MaxPixels
+	if maxPixels <= 0 {
+		maxPixels = DefaultMaxImagePixels
+	}
+	// the header alone can claim any size, so check it before allocating the pixels
+	if int64(cfg.Width)*int64(cfg.Height) > int64(maxPixels) {
+		return nil, image.Point{}, &MediaError{Type: MESSAGE_TYPE_IMAGE, Reason: MEDIA_ERROR_REASON_DIMENSIONS}
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+	if orientation >= 5 {
+		size = image.Pt(size.Y, size.X)
+	}
+	target := fitWithin(size, opts.MaxDimension)
+
+	resized := target != size
+	if !resized && orientation == 1 && !opts.StripMetadata && (format == "png" || opts.JPEGQuality == 0) {
+		return data, size, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return data, size, nil
+	}
+	img := orient(toRGBA(src), orientation)
+	if resized {
+		img = downscale(img, target.X, target.Y)
+	}
+
+	out := &bytes.Buffer{}
+	if format == "png" {
+		err = png.Encode(out, img)
+	} else {
+		quality := opts.JPEGQuality
+		if quality == 0 {
+			quality = defaultJPEGQuality
+		}
+		err = jpeg.Encode(out, img, &jpeg.Options{Quality: quality})
+	}
+	if err != nil {
+		return nil, image.Point{}, err
+	}
+	return out.Bytes(), target, nil
+}
+
+// fitWithin scales size down, keeping its aspect ratio, so that neither side exceeds max.
+func fitWithin(size image.Point, max int) image.Point {
+	if max <= 0 || (size.X <= max && size.Y <= max) {
+		return size
+	}
+	if size.X >= size.Y {
+		return image.Pt(max, maxInt(1, size.Y*max/size.X))
+	}
+	return image.Pt(maxInt(1, size.X*max/size.Y), max)
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+// downscale shrinks src to w x h by averaging the source pixels covered by each
+// destination pixel.
+func downscale(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for dy := 0; dy < h; dy++ {
+		y0, y1 := dy*sh/h, maxInt((dy+1)*sh/h, dy*sh/h+1)
+		for dx := 0; dx < w; dx++ {
+			x0, x1 := dx*sw/w, maxInt((dx+1)*sw/w, dx*sw/w+1)
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				i := src.PixOffset(x0, y)
+				for x := x0; x < x1; x++ {
+					r += uint64(src.Pix[i])
+					g += uint64(src.Pix[i+1])
+					b += uint64(src.Pix[i+2])
+					a += uint64(src.Pix[i+3])
+					i += 4
+					n++
+				}
+			}
+			j := dst.PixOffset(dx, dy)
+			dst.Pix[j] = uint8(r / n)
+			dst.Pix[j+1] = uint8(g / n)
+			dst.Pix[j+2] = uint8(b / n)
+			dst.Pix[j+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// orient applies an EXIF orientation (1-8) so the pixels display upright once the
+// metadata is gone.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	w, h := sw, sh
+	if orientation >= 5 {
+		w, h = sh, sw
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for dy := 0; dy < h; dy++ {
+		for dx := 0; dx < w; dx++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = sw-1-dx, dy
+			case 3:
+				sx, sy = sw-1-dx, sh-1-dy
+			case 4:
+				sx, sy = dx, sh-1-dy
+			case 5:
+				sx, sy = dy, dx
+			case 6:
+				sx, sy = dy, sh-1-dx
+			case 7:
+				sx, sy = sw-1-dy, sh-1-dx
+			case 8:
+				sx, sy = sw-1-dy, dx
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation tag of a JPEG, defaulting to 1.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xD9 || marker == 0xDA {
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		if marker == 0xE1 {
+			if o := exifOrientation(data[i+4 : i+2+size]); o != 0 {
+				return o
+			}
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+func exifOrientation(segment []byte) int {
+	if len(segment) < 14 || string(segment[:6]) != "Exif\x00\x00" {
+		return 0
+	}
+	tiff := segment[6:]
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for n := 0; n < count; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,196 @@
+package gapBotApi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// exifJPEG encodes a w x h JPEG whose EXIF data carries the given orientation.
+func exifJPEG(t *testing.T, w, h int, orientation uint16, order binary.ByteOrder) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	plain := &bytes.Buffer{}
+	if err := jpeg.Encode(plain, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tiff := &bytes.Buffer{}
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+	binary.Write(tiff, order, uint16(42))
+	binary.Write(tiff, order, uint32(8))
+	binary.Write(tiff, order, uint16(1))
+	binary.Write(tiff, order, uint16(0x0112))
+	binary.Write(tiff, order, uint16(3))
+	binary.Write(tiff, order, uint32(1))
+	binary.Write(tiff, order, orientation)
+	binary.Write(tiff, order, uint16(0))
+	binary.Write(tiff, order, uint32(0))
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	out := &bytes.Buffer{}
+	out.Write(plain.Bytes()[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(out, binary.BigEndian, uint16(len(segment)+2))
+	out.Write(segment)
+	out.Write(plain.Bytes()[2:])
+	return out.Bytes()
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	for o := uint16(1); o <= 8; o++ {
+		for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+			if got := jpegOrientation(exifJPEG(t, 4, 2, o, order)); got != int(o) {
+				t.Errorf("jpegOrientation(%d, %s) = %d", o, order, got)
+			}
+		}
+	}
+	plain := &bytes.Buffer{}
+	if err := jpeg.Encode(plain, image.NewRGBA(image.Rect(0, 0, 2, 2)), nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{
+		"no exif":       plain.Bytes(),
+		"out of range":  exifJPEG(t, 2, 2, 9, binary.BigEndian),
+		"not a jpeg":    pngData,
+		"truncated":     exifJPEG(t, 2, 2, 6, binary.BigEndian)[:10],
+		"empty segment": {0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x02},
+	} {
+		if got := jpegOrientation(data); got != 1 {
+			t.Errorf("jpegOrientation(%s) = %d, want 1", name, got)
+		}
+	}
+}
+
+func TestFitWithin(t *testing.T) {
+	tests := []struct {
+		size image.Point
+		max  int
+		want image.Point
+	}{
+		{image.Pt(4000, 3000), 1000, image.Pt(1000, 750)},
+		{image.Pt(3000, 4000), 1000, image.Pt(750, 1000)},
+		{image.Pt(1000, 1000), 500, image.Pt(500, 500)},
+		{image.Pt(800, 600), 1000, image.Pt(800, 600)},
+		{image.Pt(800, 600), 0, image.Pt(800, 600)},
+		{image.Pt(10000, 1), 100, image.Pt(100, 1)},
+	}
+	for _, tt := range tests {
+		if got := fitWithin(tt.size, tt.max); got != tt.want {
+			t.Errorf("fitWithin(%v, %d) = %v, want %v", tt.size, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestDownscaleAverages(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	src.Set(0, 0, color.RGBA{R: 200, A: 255})
+	src.Set(1, 0, color.RGBA{R: 100, A: 255})
+	src.Set(0, 1, color.RGBA{G: 40, A: 255})
+	src.Set(1, 1, color.RGBA{G: 60, A: 255})
+	got := downscale(src, 1, 1).RGBAAt(0, 0)
+	if want := (color.RGBA{R: 75, G: 25, A: 255}); got != want {
+		t.Errorf("downscale = %v, want %v", got, want)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// a 2x1 image with a red left and a blue right pixel
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	red, blue := color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}
+	src.SetRGBA(0, 0, red)
+	src.SetRGBA(1, 0, blue)
+	tests := []struct {
+		orientation int
+		want        [][]color.RGBA
+	}{
+		{1, [][]color.RGBA{{red, blue}}},
+		{2, [][]color.RGBA{{blue, red}}},
+		{3, [][]color.RGBA{{blue, red}}},
+		{6, [][]color.RGBA{{red}, {blue}}},
+		{8, [][]color.RGBA{{blue}, {red}}},
+	}
+	for _, tt := range tests {
+		dst := orient(src, tt.orientation)
+		for y, row := range tt.want {
+			for x, want := range row {
+				if got := dst.RGBAAt(x, y); got != want {
+					t.Errorf("orient(%d) at %d,%d = %v, want %v", tt.orientation, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestProcessImage(t *testing.T) {
+	pngPhoto := &bytes.Buffer{}
+	if err := png.Encode(pngPhoto, image.NewRGBA(image.Rect(0, 0, 400, 200))); err != nil {
+		t.Fatal(err)
+	}
+	gifPhoto := &bytes.Buffer{}
+	if err := gif.Encode(gifPhoto, image.NewPaletted(image.Rect(0, 0, 400, 200), color.Palette{color.Black}), nil); err != nil {
+		t.Fatal(err)
+	}
+	rotated := exifJPEG(t, 400, 200, 6, binary.BigEndian)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		opts      ImageOptions
+		size      image.Point
+		unchanged bool
+		reason    MEDIA_ERROR_REASON
+	}{
+		{name: "png untouched", data: pngPhoto.Bytes(), size: image.Pt(400, 200), unchanged: true},
+		{name: "png downscaled", data: pngPhoto.Bytes(), opts: ImageOptions{MaxDimension: 100}, size: image.Pt(100, 50)},
+		{name: "exif rotated upright", data: rotated, size: image.Pt(200, 400)},
+		{name: "exif rotated and downscaled", data: rotated, opts: ImageOptions{MaxDimension: 100}, size: image.Pt(50, 100)},
+		{name: "gif passed through", data: gifPhoto.Bytes(), opts: ImageOptions{MaxDimension: 100, StripMetadata: true}, size: image.Pt(400, 200), unchanged: true},
+		{name: "not an image", data: textData, opts: ImageOptions{StripMetadata: true}, unchanged: true},
+		{name: "too many pixels", data: pngPhoto.Bytes(), opts: ImageOptions{MaxPixels: 1000}, reason: MEDIA_ERROR_REASON_DIMENSIONS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, size, err := processImage(tt.data, tt.opts)
+			if tt.reason != "" {
+				var mErr *MediaError
+				if !errors.As(err, &mErr) || mErr.Reason != tt.reason {
+					t.Fatalf("processImage() = %v, want reason %s", err, tt.reason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != tt.size {
+				t.Errorf("size = %v, want %v", size, tt.size)
+			}
+			if got := bytes.Equal(out, tt.data); got != tt.unchanged {
+				t.Errorf("unchanged = %v, want %v", got, tt.unchanged)
+			}
+			if tt.unchanged {
+				return
+			}
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := image.Pt(cfg.Width, cfg.Height); got != tt.size {
+				t.Errorf("encoded size = %v, want %v", got, tt.size)
+			}
+			if jpegOrientation(out) != 1 {
+				t.Errorf("re-encoded photo still has an orientation")
+			}
+		})
+	}
+}
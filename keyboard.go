@@ -0,0 +1,156 @@
+package gapBotApi
+
+import "strconv"
+
+// PageParam is the callback param carrying the page number of paginated keyboards.
+const PageParam = "page"
+
+// KeyboardBuilder lays inline keyboard buttons out in rows of Columns buttons and,
+// once paginated, splits them into pages with previous and next buttons that route
+// back to StatePath with the page number in PageParam.
+type KeyboardBuilder struct {
+	Columns   int
+	PageSize  int
+	StatePath string
+	// Params are carried by the navigation buttons along with the page number.
+	Params   map[string]string
+	PrevText string
+	NextText string
+	// Codec encodes the navigation buttons. Defaults to JSONCallbackCodec, or to the
+	// bot's CallbackCodec in Ctx.ShowPage.
+	Codec   CallbackCodec
+	buttons []InlineKeyboardButton
+}
+
+func NewKeyboardBuilder(columns int) *KeyboardBuilder {
+	return &KeyboardBuilder{
+		Columns:  columns,
+		PrevText: "«",
+		NextText: "»",
+	}
+}
+
+func (kb *KeyboardBuilder) Add(buttons ...InlineKeyboardButton) *KeyboardBuilder {
+	kb.buttons = append(kb.buttons, buttons...)
+	return kb
+}
+
+// Paginate shows pageSize buttons per page, navigating between pages through statePath.
+func (kb *KeyboardBuilder) Paginate(pageSize int, statePath string) *KeyboardBuilder {
+	kb.PageSize = pageSize
+	kb.StatePath = statePath
+	return kb
+}
+
+// Pages returns the number of pages, which is at least one.
+func (kb *KeyboardBuilder) Pages() int {
+	if kb.PageSize <= 0 || len(kb.buttons) == 0 {
+		return 1
+	}
+	return (len(kb.buttons) + kb.PageSize - 1) / kb.PageSize
+}
+
+// Build returns the keyboard of a page, counting from zero. Out of range pages are
+// clamped to the first or last page. It fails when Codec cannot encode the
+// navigation buttons.
+func (kb *KeyboardBuilder) Build(page int) (InlineKeyboardMarkup, error) {
+	codec := kb.Codec
+	if codec == nil {
+		codec = JSONCallbackCodec{}
+	}
+	return kb.build(page, codec)
+}
+
+// build is Build encoding the navigation buttons with codec.
+func (kb *KeyboardBuilder) build(page int, codec CallbackCodec) (InlineKeyboardMarkup, error) {
+	if page >= kb.Pages() {
+		page = kb.Pages() - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	buttons := kb.buttons
+	if kb.PageSize > 0 {
+		start := page * kb.PageSize
+		end := start + kb.PageSize
+		if end > len(buttons) {
+			end = len(buttons)
+		}
+		buttons = buttons[start:end]
+	}
+
+	columns := kb.Columns
+	if columns <= 0 {
+		columns = 1
+	}
+	markup := NewInlineKeyboardMarkup()
+	for start := 0; start < len(buttons); start += columns {
+		end := start + columns
+		if end > len(buttons) {
+			end = len(buttons)
+		}
+		markup = markup.AddRow(NewInlineKeyboardRow(buttons[start:end]...))
+	}
+
+	var nav []InlineKeyboardButton
+	if page > 0 {
+		button, err := kb.navButton(codec, kb.PrevText, page-1)
+		if err != nil {
+			return nil, err
+		}
+		nav = append(nav, button)
+	}
+	if page < kb.Pages()-1 {
+		button, err := kb.navButton(codec, kb.NextText, page+1)
+		if err != nil {
+			return nil, err
+		}
+		nav = append(nav, button)
+	}
+	if len(nav) > 0 {
+		markup = markup.AddRow(nav)
+	}
+	return markup, nil
+}
+
+func (kb *KeyboardBuilder) navButton(codec CallbackCodec, text string, page int) (InlineKeyboardButton, error) {
+	params := make(map[string]string, len(kb.Params)+1)
+	for k, v := range kb.Params {
+		params[k] = v
+	}
+	params[PageParam] = strconv.Itoa(page)
+	return NewInlineKeyboardButtonWithCodec(codec, text, CallbackQueryAction{
+		StatePath: kb.StatePath,
+		Params:    params,
+	})
+}
+
+// Page returns the page requested by a keyboard navigation button, or zero.
+func (ctx *Ctx) Page() int {
+	page, _ := strconv.Atoi(ctx.stringParam(PageParam))
+	return page
+}
+
+// ShowPage shows the requested page of kb under text. When the update comes from a
+// navigation button the message holding the keyboard is edited in place, otherwise
+// a new message is sent.
+func (ctx *Ctx) ShowPage(text string, kb *KeyboardBuilder) (Message, error) {
+	codec := kb.Codec
+	if codec == nil {
+		codec = ctx.bot.callbackCodec()
+	}
+	markup, err := kb.build(ctx.Page(), codec)
+	if err != nil {
+		return Message{}, err
+	}
+	if ctx.Message.Type == MESSAGE_TYPE_TRIGGER_BUTTON && ctx.stringParam(PageParam) != "" {
+		return ctx.Edit(text, WithInlineKeyboard(markup))
+	}
+	return ctx.Send(text, WithInlineKeyboard(markup))
+}
+
+func (ctx *Ctx) stringParam(key string) string {
+	value, _ := ctx.GetParam(key).(string)
+	return value
+}
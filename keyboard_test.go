@@ -0,0 +1,154 @@
+package gapBotApi
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// keyboardLayout renders the button texts of a keyboard row by row.
+func keyboardLayout(markup InlineKeyboardMarkup) string {
+	rows := make([]string, len(markup))
+	for i, row := range markup {
+		texts := make([]string, len(row))
+		for j, button := range row {
+			texts[j] = button.Text
+		}
+		rows[i] = strings.Join(texts, " ")
+	}
+	return strings.Join(rows, " | ")
+}
+
+func numberedKeyboard(columns, count int) *KeyboardBuilder {
+	kb := NewKeyboardBuilder(columns)
+	for i := 1; i <= count; i++ {
+		kb.Add(InlineKeyboardButton{Text: strconv.Itoa(i), CallbackData: "item"})
+	}
+	return kb
+}
+
+func TestKeyboardBuilderBuild(t *testing.T) {
+	tests := []struct {
+		name  string
+		kb    *KeyboardBuilder
+		page  int
+		pages int
+		want  string
+	}{
+		{name: "not paginated", kb: numberedKeyboard(2, 5), pages: 1, want: "1 2 | 3 4 | 5"},
+		{name: "no columns", kb: numberedKeyboard(0, 2), pages: 1, want: "1 | 2"},
+		{name: "empty", kb: numberedKeyboard(2, 0).Paginate(3, "/list"), pages: 1, want: ""},
+		{name: "first page", kb: numberedKeyboard(2, 7).Paginate(3, "/list"), page: 0, pages: 3, want: "1 2 | 3 | »"},
+		{name: "middle page", kb: numberedKeyboard(2, 7).Paginate(3, "/list"), page: 1, pages: 3, want: "4 5 | 6 | « »"},
+		{name: "last page", kb: numberedKeyboard(2, 7).Paginate(3, "/list"), page: 2, pages: 3, want: "7 | «"},
+		{name: "page past the end", kb: numberedKeyboard(2, 7).Paginate(3, "/list"), page: 9, pages: 3, want: "7 | «"},
+		{name: "negative page", kb: numberedKeyboard(2, 7).Paginate(3, "/list"), page: -1, pages: 3, want: "1 2 | 3 | »"},
+		{name: "exactly one page", kb: numberedKeyboard(3, 3).Paginate(3, "/list"), pages: 1, want: "1 2 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if pages := tt.kb.Pages(); pages != tt.pages {
+				t.Errorf("Pages() = %d, want %d", pages, tt.pages)
+			}
+			markup, err := tt.kb.Build(tt.page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := keyboardLayout(markup); got != tt.want {
+				t.Errorf("Build(%d) = %q, want %q", tt.page, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyboardBuilderNavigation(t *testing.T) {
+	kb := numberedKeyboard(2, 7).Paginate(3, "/list")
+	kb.Params = map[string]string{"cat": "books"}
+	kb.Codec = CompactCallbackCodec{}
+	markup, err := kb.Build(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nav := markup[len(markup)-1]
+	for i, want := range []string{"0", "2"} {
+		action, err := kb.Codec.Decode(nav[i].CallbackData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantParams := map[string]string{"cat": "books", PageParam: want}
+		if action.StatePath != "/list" || !reflect.DeepEqual(action.Params, wantParams) {
+			t.Errorf("%s routes to %s %v, want /list %v", nav[i].Text, action.StatePath, action.Params, wantParams)
+		}
+	}
+	if kb.Params[PageParam] != "" {
+		t.Error("Build() wrote the page number into KeyboardBuilder.Params")
+	}
+}
+
+// failingCodec cannot encode any action.
+type failingCodec struct{ JSONCallbackCodec }
+
+func (failingCodec) Encode(CallbackQueryAction) (string, error) {
+	return "", errors.New("too long")
+}
+
+func TestKeyboardBuilderCodecError(t *testing.T) {
+	kb := numberedKeyboard(2, 7).Paginate(3, "/list")
+	kb.Codec = failingCodec{}
+	if _, err := kb.Build(1); err == nil {
+		t.Error("Build() ignored a codec error")
+	}
+	if _, err := numberedKeyboard(2, 2).Paginate(3, "/list").Build(0); err != nil {
+		t.Errorf("Build() of a single page without navigation = %v", err)
+	}
+}
+
+func TestCtxShowPage(t *testing.T) {
+	tests := []struct {
+		name    string
+		message *Message
+		page    string
+		method  string
+	}{
+		{name: "command", message: &Message{ChatID: 1, MessageID: 5, Type: MESSAGE_TYPE_TEXT, Text: "/list"}, method: "sendMessage"},
+		{name: "navigation button", message: &Message{ChatID: 1, MessageID: 5, Type: MESSAGE_TYPE_TRIGGER_BUTTON}, page: "1", method: "editMessage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, calls := recordingBot(t)
+			bot.CallbackCodec = CompactCallbackCodec{}
+			ctx := newTestCtx(bot, tt.message)
+			if tt.page != "" {
+				ctx.Params[PageParam] = tt.page
+			}
+			kb := numberedKeyboard(2, 7).Paginate(3, "/list")
+			if _, err := ctx.ShowPage("items", kb); err != nil {
+				t.Fatal(err)
+			}
+			if kb.Codec != nil {
+				t.Error("ShowPage() set KeyboardBuilder.Codec")
+			}
+			if len(*calls) != 1 {
+				t.Fatalf("%d calls, want 1", len(*calls))
+			}
+			call := (*calls)[0]
+			if call.Get("method") != tt.method || call.Get("chat_id") != "1" || call.Get("data") != "items" {
+				t.Errorf("ShowPage() sent %v, want %s", call, tt.method)
+			}
+			if tt.method == "editMessage" && call.Get("message_id") != "5" {
+				t.Errorf("edit of message %q, want 5", call.Get("message_id"))
+			}
+			var markup InlineKeyboardMarkup
+			if err := json.Unmarshal([]byte(call.Get("inline_keyboard")), &markup); err != nil {
+				t.Fatal(err)
+			}
+			nav := markup[len(markup)-1]
+			if data := nav[len(nav)-1].CallbackData; !strings.HasPrefix(data, "/list?") {
+				t.Errorf("navigation button data %q not encoded with the bot's codec", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package gapBotApi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrLedgerNotFound   = errors.New("ledger entry not found")
+	ErrLedgerExists     = errors.New("ledger entry already exists")
+	ErrDuplicatePayment = errors.New("duplicate payment callback")
+	ErrPaymentFinal     = errors.New("payment is already final")
+	ErrLedgerConflict   = errors.New("ledger entry status has changed")
+)
+
+// LedgerEntry is a payment button issued to a chat and what became of it.
+type LedgerEntry struct {
+	RefId       string
+	ChatID      int64
+	Amount      int
+	Currency    INLINE_KEYBOARD_CURRENCY
+	Description string
+	Status      PAYMENT_STATUS
+	MessageId   string
+	// Callbacks counts the pay callbacks received for the entry, duplicates included.
+	Callbacks int
+	IssuedAt  time.Time
+	UpdatedAt time.Time
+	// ExpiresAt is zero for entries that never expire.
+	ExpiresAt time.Time
+}
+
+// LedgerStore persists ledger entries.
+type LedgerStore interface {
+	// Insert adds a new entry or returns ErrLedgerExists.
+	Insert(ctx context.Context, entry LedgerEntry) error
+	// Get returns the entry of a RefId or ErrLedgerNotFound.
+	Get(ctx context.Context, refId string) (LedgerEntry, error)
+	// Update replaces an existing entry or returns ErrLedgerNotFound.
+	Update(ctx context.Context, entry LedgerEntry) error
+	// UpdateIfStatus replaces an existing entry only while its stored status is still
+	// status, atomically for every process sharing the store. It returns
+	// ErrLedgerConflict when the status has changed and ErrLedgerNotFound when there
+	// is no entry.
+	UpdateIfStatus(ctx context.Context, entry LedgerEntry, status PAYMENT_STATUS) error
+	// ListByStatus returns the entries in a status, oldest first.
+	ListByStatus(ctx context.Context, status PAYMENT_STATUS) ([]LedgerEntry, error)
+}
+
+// Ledger reconciles the payment buttons a bot issues with the pay callbacks Gap
+// sends for them. Set it as BotAPI.Ledger to record callbacks before routing.
+type Ledger struct {
+	Store LedgerStore
+	// TTL is how long an issued button stays payable. Zero means forever.
+	TTL time.Duration
+	mu  sync.Mutex
+}
+
+func NewLedger(store LedgerStore, ttl time.Duration) *Ledger {
+	return &Ledger{
+		Store: store,
+		TTL:   ttl,
+	}
+}
+
+// Issue records a payment button, as built by NewInlineKeyboardButtonPayment, sent to a chat.
+func (l *Ledger) Issue(ctx context.Context, chatID int64, button InlineKeyboardButton) (LedgerEntry, error) {
+	if button.RefId == "" {
+		return LedgerEntry{}, errors.New("payment button has no RefId")
+	}
+	now := time.Now()
+	entry := LedgerEntry{
+		RefId:       button.RefId,
+		ChatID:      chatID,
+		Amount:      button.Amount,
+		Currency:    button.Currency,
+		Description: button.Description,
+		Status:      PAYMENT_STATUS_PENDING,
+		IssuedAt:    now,
+		UpdatedAt:   now,
+	}
+	if l.TTL > 0 {
+		entry.ExpiresAt = now.Add(l.TTL)
+	}
+	return entry, l.Store.Insert(ctx, entry)
+}
+
+// Record applies a pay callback to its entry. A callback repeating the current status,
+// or a paid callback for a verified payment, returns ErrDuplicatePayment and one
+// contradicting a final status ErrPaymentFinal;
+// the returned entry is current in both cases. HandleUpdates drops duplicates and
+// routes conflicts with Ctx.PaymentConflict set.
+//
+// The entry is only written while its status is the one read, so when bots sharing
+// a store race on the same callback, one applies it and the others see a duplicate.
+func (l *Ledger) Record(ctx context.Context, info PaymentInfo) (LedgerEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for {
+		entry, err := l.Store.Get(ctx, info.RefId)
+		if err != nil {
+			return entry, err
+		}
+		status := entry.Status
+		entry.Callbacks++
+		entry.UpdatedAt = time.Now()
+
+		switch {
+		case entry.Status == info.Status,
+			// the paid callback of a payment verified since is redelivered
+			entry.Status == PAYMENT_STATUS_VERIFIED && info.Status == PAYMENT_STATUS_PAID:
+			err = ErrDuplicatePayment
+		case entry.Status.IsFinal():
+			err = fmt.Errorf("%w: %s is %s, callback says %s", ErrPaymentFinal, entry.RefId, entry.Status, info.Status)
+		default:
+			entry.Status = info.Status
+			entry.MessageId = info.MessageId
+		}
+		updateErr := l.Store.UpdateIfStatus(ctx, entry, status)
+		if errors.Is(updateErr, ErrLedgerConflict) {
+			continue
+		}
+		if updateErr != nil {
+			return entry, updateErr
+		}
+		return entry, err
+	}
+}
+
+// SetStatus moves the entry of refId to status, e.g. once its payment is verified.
+// An entry already in a different final status is left alone and ErrPaymentFinal is
+// returned.
+func (l *Ledger) SetStatus(ctx context.Context, refId string, status PAYMENT_STATUS) (LedgerEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for {
+		entry, err := l.Store.Get(ctx, refId)
+		if err != nil || entry.Status == status {
+			return entry, err
+		}
+		if entry.Status.IsFinal() {
+			return entry, fmt.Errorf("%w: %s is %s", ErrPaymentFinal, entry.RefId, entry.Status)
+		}
+		previous := entry.Status
+		entry.Status = status
+		entry.UpdatedAt = time.Now()
+		err = l.Store.UpdateIfStatus(ctx, entry, previous)
+		if errors.Is(err, ErrLedgerConflict) {
+			continue
+		}
+		return entry, err
+	}
+}
+
+// Pending returns the entries still waiting for a callback that have not expired.
+func (l *Ledger) Pending(ctx context.Context) ([]LedgerEntry, error) {
+	return l.pending(ctx, false)
+}
+
+// Expired returns the pending entries whose TTL has passed without a callback.
+func (l *Ledger) Expired(ctx context.Context) ([]LedgerEntry, error) {
+	return l.pending(ctx, true)
+}
+
+// ExpireStale moves the expired entries to PAYMENT_STATUS_EXPIRED and returns them.
+// Entries that received a callback in the meantime are left alone.
+func (l *Ledger) ExpireStale(ctx context.Context) ([]LedgerEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries, err := l.pending(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	expired := entries[:0]
+	for _, entry := range entries {
+		entry.Status = PAYMENT_STATUS_EXPIRED
+		entry.UpdatedAt = time.Now()
+		err := l.Store.UpdateIfStatus(ctx, entry, PAYMENT_STATUS_PENDING)
+		if errors.Is(err, ErrLedgerConflict) {
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired = append(expired, entry)
+	}
+	return expired, nil
+}
+
+func (l *Ledger) pending(ctx context.Context, expired bool) ([]LedgerEntry, error) {
+	entries, err := l.Store.ListByStatus(ctx, PAYMENT_STATUS_PENDING)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	result := make([]LedgerEntry, 0, len(entries))
+	for _, entry := range entries {
+		isExpired := !entry.ExpiresAt.IsZero() && now.After(entry.ExpiresAt)
+		if isExpired == expired {
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
+
+// MemoryLedgerStore is a LedgerStore that keeps entries in memory.
+type MemoryLedgerStore struct {
+	mu      sync.RWMutex
+	entries map[string]LedgerEntry
+}
+
+func NewMemoryLedgerStore() *MemoryLedgerStore {
+	return &MemoryLedgerStore{
+		entries: make(map[string]LedgerEntry),
+	}
+}
+
+func (s *MemoryLedgerStore) Insert(_ context.Context, entry LedgerEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[entry.RefId]; ok {
+		return ErrLedgerExists
+	}
+	s.entries[entry.RefId] = entry
+	return nil
+}
+
+func (s *MemoryLedgerStore) Get(_ context.Context, refId string) (LedgerEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.entries[refId]
+	if !ok {
+		return LedgerEntry{}, ErrLedgerNotFound
+	}
+	return entry, nil
+}
+
+func (s *MemoryLedgerStore) Update(_ context.Context, entry LedgerEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[entry.RefId]; !ok {
+		return ErrLedgerNotFound
+	}
+	s.entries[entry.RefId] = entry
+	return nil
+}
+
+func (s *MemoryLedgerStore) UpdateIfStatus(_ context.Context, entry LedgerEntry, status PAYMENT_STATUS) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.entries[entry.RefId]
+	if !ok {
+		return ErrLedgerNotFound
+	}
+	if stored.Status != status {
+		return ErrLedgerConflict
+	}
+	s.entries[entry.RefId] = entry
+	return nil
+}
+
+func (s *MemoryLedgerStore) ListByStatus(_ context.Context, status PAYMENT_STATUS) ([]LedgerEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var entries []LedgerEntry
+	for _, entry := range s.entries {
+		if entry.Status == status {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].IssuedAt.Before(entries[j].IssuedAt)
+	})
+	return entries, nil
+}
@@ -0,0 +1,209 @@
+package gapBotApi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// SQLLedgerStore is a LedgerStore backed by a database/sql table. Times are stored
+// as unix milliseconds so the table works the same with any driver.
+type SQLLedgerStore struct {
+	DB    *sql.DB
+	Table string
+	// Placeholder formats the n-th query argument, counting from 1. It defaults to
+	// "?"; use DollarPlaceholder for PostgreSQL.
+	Placeholder func(n int) string
+}
+
+func NewSQLLedgerStore(db *sql.DB, table string) *SQLLedgerStore {
+	if table == "" {
+		table = "gap_payment_ledger"
+	}
+	return &SQLLedgerStore{
+		DB:    db,
+		Table: table,
+	}
+}
+
+// DollarPlaceholder formats query arguments as $1, $2, ...
+func DollarPlaceholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+const ledgerColumns = "ref_id, chat_id, amount, currency, description, status, message_id, callbacks, issued_at, updated_at, expires_at"
+
+// CreateTable creates the ledger table if it does not exist yet.
+func (s *SQLLedgerStore) CreateTable(ctx context.Context) error {
+	_, err := s.DB.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	ref_id VARCHAR(255) NOT NULL PRIMARY KEY,
+	chat_id BIGINT NOT NULL,
+	amount BIGINT NOT NULL,
+	currency VARCHAR(16) NOT NULL,
+	description TEXT NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	message_id VARCHAR(64) NOT NULL,
+	callbacks INTEGER NOT NULL,
+	issued_at BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL,
+	expires_at BIGINT NOT NULL
+)`, s.Table))
+	return err
+}
+
+func (s *SQLLedgerStore) Insert(ctx context.Context, entry LedgerEntry) error {
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", s.Table, ledgerColumns, s.placeholders(1, 11))
+	_, err := s.DB.ExecContext(ctx, query, ledgerValues(entry)...)
+	if err != nil {
+		if _, getErr := s.Get(ctx, entry.RefId); getErr == nil {
+			return ErrLedgerExists
+		}
+	}
+	return err
+}
+
+func (s *SQLLedgerStore) Get(ctx context.Context, refId string) (LedgerEntry, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE ref_id = %s", ledgerColumns, s.Table, s.placeholder(1))
+	entry, err := scanLedgerEntry(s.DB.QueryRowContext(ctx, query, refId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return entry, ErrLedgerNotFound
+	}
+	return entry, err
+}
+
+func (s *SQLLedgerStore) Update(ctx context.Context, entry LedgerEntry) error {
+	n, err := s.update(ctx, entry, "")
+	if err != nil || n > 0 {
+		return err
+	}
+	// MySQL counts the rows changed rather than matched, so rewriting an entry
+	// as it is affects no rows
+	_, err = s.Get(ctx, entry.RefId)
+	return err
+}
+
+// UpdateIfStatus checks the status in the WHERE clause of the UPDATE, so the
+// database decides which of two concurrent writers wins.
+func (s *SQLLedgerStore) UpdateIfStatus(ctx context.Context, entry LedgerEntry, status PAYMENT_STATUS) error {
+	n, err := s.update(ctx, entry, status)
+	if err != nil || n > 0 {
+		return err
+	}
+	stored, err := s.Get(ctx, entry.RefId)
+	if err != nil {
+		return err
+	}
+	// no rows affected also means the entry was already stored as it is on MySQL
+	if stored.Status == status && reflect.DeepEqual(ledgerValues(stored), ledgerValues(entry)) {
+		return nil
+	}
+	return ErrLedgerConflict
+}
+
+// update writes entry, only while its stored status is status unless that is
+// empty, and returns the number of rows written.
+func (s *SQLLedgerStore) update(ctx context.Context, entry LedgerEntry, status PAYMENT_STATUS) (int64, error) {
+	columns := strings.Split(ledgerColumns, ", ")[1:]
+	sets := make([]string, len(columns))
+	for i, column := range columns {
+		sets[i] = column + " = " + s.placeholder(i+1)
+	}
+	values := ledgerValues(entry)
+	args := append(values[1:], entry.RefId)
+	where := "ref_id = " + s.placeholder(len(columns)+1)
+	if status != "" {
+		where += " AND status = " + s.placeholder(len(columns)+2)
+		args = append(args, string(status))
+	}
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", s.Table, strings.Join(sets, ", "), where)
+	result, err := s.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *SQLLedgerStore) ListByStatus(ctx context.Context, status PAYMENT_STATUS) ([]LedgerEntry, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE status = %s ORDER BY issued_at", ledgerColumns, s.Table, s.placeholder(1))
+	rows, err := s.DB.QueryContext(ctx, query, string(status))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []LedgerEntry
+	for rows.Next() {
+		entry, err := scanLedgerEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *SQLLedgerStore) placeholder(n int) string {
+	if s.Placeholder == nil {
+		return "?"
+	}
+	return s.Placeholder(n)
+}
+
+func (s *SQLLedgerStore) placeholders(from, count int) string {
+	list := make([]string, count)
+	for i := range list {
+		list[i] = s.placeholder(from + i)
+	}
+	return strings.Join(list, ", ")
+}
+
+func ledgerValues(entry LedgerEntry) []interface{} {
+	return []interface{}{
+		entry.RefId,
+		entry.ChatID,
+		entry.Amount,
+		string(entry.Currency),
+		entry.Description,
+		string(entry.Status),
+		entry.MessageId,
+		entry.Callbacks,
+		unixMilli(entry.IssuedAt),
+		unixMilli(entry.UpdatedAt),
+		unixMilli(entry.ExpiresAt),
+	}
+}
+
+func scanLedgerEntry(row interface{ Scan(...interface{}) error }) (LedgerEntry, error) {
+	var entry LedgerEntry
+	var currency, status string
+	var issuedAt, updatedAt, expiresAt int64
+	err := row.Scan(&entry.RefId, &entry.ChatID, &entry.Amount, &currency, &entry.Description, &status,
+		&entry.MessageId, &entry.Callbacks, &issuedAt, &updatedAt, &expiresAt)
+	if err != nil {
+		return LedgerEntry{}, err
+	}
+	entry.Currency = INLINE_KEYBOARD_CURRENCY(currency)
+	entry.Status = PAYMENT_STATUS(status)
+	entry.IssuedAt = fromUnixMilli(issuedAt)
+	entry.UpdatedAt = fromUnixMilli(updatedAt)
+	entry.ExpiresAt = fromUnixMilli(expiresAt)
+	return entry, nil
+}
+
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func fromUnixMilli(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
@@ -0,0 +1,193 @@
+package gapBotApi
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeLedgerDriver is a database/sql driver that understands just the queries
+// SQLLedgerStore runs. Databases whose name starts with "mysql" report the rows an
+// UPDATE changed as affected, like MySQL does, rather than the rows it matched.
+type fakeLedgerDriver struct {
+	mu  sync.Mutex
+	dbs map[string]map[string][]driver.Value
+}
+
+var ledgerDriver = &fakeLedgerDriver{dbs: make(map[string]map[string][]driver.Value)}
+
+func init() {
+	sql.Register("fakeledger", ledgerDriver)
+}
+
+var (
+	insertQuery = regexp.MustCompile(`^INSERT INTO \w+ \(`)
+	selectQuery = regexp.MustCompile(`^SELECT .* FROM \w+ WHERE (ref_id|status) = `)
+	updateQuery = regexp.MustCompile(`^UPDATE \w+ SET `)
+)
+
+func (d *fakeLedgerDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.dbs[name] == nil {
+		d.dbs[name] = make(map[string][]driver.Value)
+	}
+	return &fakeLedgerConn{driver: d, name: name}, nil
+}
+
+type fakeLedgerConn struct {
+	driver *fakeLedgerDriver
+	name   string
+}
+
+func (c *fakeLedgerConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeLedgerStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeLedgerConn) Close() error { return nil }
+
+func (c *fakeLedgerConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type fakeLedgerStmt struct {
+	conn  *fakeLedgerConn
+	query string
+}
+
+func (s *fakeLedgerStmt) Close() error  { return nil }
+func (s *fakeLedgerStmt) NumInput() int { return -1 }
+
+func (s *fakeLedgerStmt) Exec(args []driver.Value) (driver.Result, error) {
+	d := s.conn.driver
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	rows := d.dbs[s.conn.name]
+	switch {
+	case strings.HasPrefix(s.query, "CREATE TABLE"):
+		return driver.RowsAffected(0), nil
+	case insertQuery.MatchString(s.query):
+		refId := args[0].(string)
+		if _, ok := rows[refId]; ok {
+			return nil, fmt.Errorf("duplicate key %q", refId)
+		}
+		rows[refId] = append([]driver.Value(nil), args...)
+		return driver.RowsAffected(1), nil
+	case updateQuery.MatchString(s.query):
+		refId := args[10].(string)
+		row, ok := rows[refId]
+		if !ok || (len(args) > 11 && row[5] != args[11]) {
+			return driver.RowsAffected(0), nil
+		}
+		updated := append([]driver.Value{refId}, args[:10]...)
+		if strings.HasPrefix(s.conn.name, "mysql") && reflect.DeepEqual(row, updated) {
+			return driver.RowsAffected(0), nil
+		}
+		rows[refId] = updated
+		return driver.RowsAffected(1), nil
+	}
+	return nil, fmt.Errorf("unexpected exec %q", s.query)
+}
+
+func (s *fakeLedgerStmt) Query(args []driver.Value) (driver.Rows, error) {
+	d := s.conn.driver
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	match := selectQuery.FindStringSubmatch(s.query)
+	if match == nil {
+		return nil, fmt.Errorf("unexpected query %q", s.query)
+	}
+	column := 0
+	if match[1] == "status" {
+		column = 5
+	}
+	result := &fakeLedgerRows{}
+	for _, row := range d.dbs[s.conn.name] {
+		if row[column] == args[0] {
+			result.rows = append(result.rows, row)
+		}
+	}
+	sort.Slice(result.rows, func(i, j int) bool {
+		return result.rows[i][8].(int64) < result.rows[j][8].(int64)
+	})
+	return result, nil
+}
+
+type fakeLedgerRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeLedgerRows) Columns() []string {
+	return strings.Split(ledgerColumns, ", ")
+}
+
+func (r *fakeLedgerRows) Close() error { return nil }
+
+func (r *fakeLedgerRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// newFakeSQLLedgerStore returns an SQLLedgerStore on a new, empty fake database.
+func newFakeSQLLedgerStore(t *testing.T, dialect string) *SQLLedgerStore {
+	t.Helper()
+	db, err := sql.Open("fakeledger", dialect+"/"+t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store := NewSQLLedgerStore(db, "")
+	if err := store.CreateTable(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestSQLLedgerStoreSameStatusRewrite(t *testing.T) {
+	for _, dialect := range []string{"sqlite", "mysql"} {
+		t.Run(dialect, func(t *testing.T) {
+			store := newFakeSQLLedgerStore(t, dialect)
+			ctx := context.Background()
+			entry := LedgerEntry{RefId: "r", ChatID: 1, Amount: 10, Status: PAYMENT_STATUS_PENDING}
+			if err := store.Insert(ctx, entry); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.UpdateIfStatus(ctx, entry, PAYMENT_STATUS_PENDING); err != nil {
+				t.Errorf("UpdateIfStatus() rewriting the entry = %v", err)
+			}
+			if err := store.Update(ctx, entry); err != nil {
+				t.Errorf("Update() rewriting the entry = %v", err)
+			}
+
+			changed := entry
+			changed.Status = PAYMENT_STATUS_PAID
+			if err := store.UpdateIfStatus(ctx, changed, PAYMENT_STATUS_PENDING); err != nil {
+				t.Fatal(err)
+			}
+			// a second writer still expecting the entry to be pending must lose
+			if err := store.UpdateIfStatus(ctx, changed, PAYMENT_STATUS_PENDING); !errors.Is(err, ErrLedgerConflict) {
+				t.Errorf("UpdateIfStatus() with a stale status = %v, want ErrLedgerConflict", err)
+			}
+			missing := LedgerEntry{RefId: "missing"}
+			if err := store.Update(ctx, missing); !errors.Is(err, ErrLedgerNotFound) {
+				t.Errorf("Update() of a missing entry = %v, want ErrLedgerNotFound", err)
+			}
+			if err := store.UpdateIfStatus(ctx, missing, PAYMENT_STATUS_PENDING); !errors.Is(err, ErrLedgerNotFound) {
+				t.Errorf("UpdateIfStatus() of a missing entry = %v, want ErrLedgerNotFound", err)
+			}
+		})
+	}
+}
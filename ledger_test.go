@@ -0,0 +1,239 @@
+package gapBotApi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// ledgerStores returns a new, empty store of each kind.
+func ledgerStores(t *testing.T) map[string]LedgerStore {
+	return map[string]LedgerStore{
+		"memory": NewMemoryLedgerStore(),
+		"sql":    newFakeSQLLedgerStore(t, "sqlite"),
+		"mysql":  newFakeSQLLedgerStore(t, "mysql"),
+	}
+}
+
+func payButton(refId string) InlineKeyboardButton {
+	return NewInlineKeyboardButtonPayment("Pay", 1000, INLINE_KEYBOARD_CURRENCY_IRR, refId, "Order "+refId)
+}
+
+func TestLedgerRecord(t *testing.T) {
+	steps := []struct {
+		name      string
+		status    PAYMENT_STATUS
+		verify    bool
+		err       error
+		want      PAYMENT_STATUS
+		callbacks int
+	}{
+		{name: "paid", status: PAYMENT_STATUS_PAID, want: PAYMENT_STATUS_PAID, callbacks: 1},
+		{name: "duplicate", status: PAYMENT_STATUS_PAID, err: ErrDuplicatePayment, want: PAYMENT_STATUS_PAID, callbacks: 2},
+		{name: "verified", verify: true, want: PAYMENT_STATUS_VERIFIED, callbacks: 2},
+		{name: "verified paid again", status: PAYMENT_STATUS_PAID, err: ErrDuplicatePayment, want: PAYMENT_STATUS_VERIFIED, callbacks: 3},
+		{name: "contradicts final status", status: PAYMENT_STATUS_ERROR, err: ErrPaymentFinal, want: PAYMENT_STATUS_VERIFIED, callbacks: 4},
+		{name: "repeats final status", status: PAYMENT_STATUS_VERIFIED, err: ErrDuplicatePayment, want: PAYMENT_STATUS_VERIFIED, callbacks: 5},
+	}
+	for name, store := range ledgerStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			ledger := NewLedger(store, 0)
+			if _, err := ledger.Issue(ctx, 1, payButton("order-1")); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ledger.Issue(ctx, 1, payButton("order-1")); !errors.Is(err, ErrLedgerExists) {
+				t.Errorf("Issue() twice = %v, want ErrLedgerExists", err)
+			}
+			if _, err := ledger.Issue(ctx, 1, InlineKeyboardButton{Text: "Pay"}); err == nil {
+				t.Error("Issue() accepted a button without RefId")
+			}
+
+			for _, step := range steps {
+				var err error
+				if step.verify {
+					_, err = ledger.SetStatus(ctx, "order-1", PAYMENT_STATUS_VERIFIED)
+				} else {
+					_, err = ledger.Record(ctx, PaymentInfo{RefId: "order-1", MessageId: "m", Status: step.status})
+				}
+				if !errors.Is(err, step.err) {
+					t.Errorf("%s: err = %v, want %v", step.name, err, step.err)
+				}
+				entry, err := store.Get(ctx, "order-1")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if entry.Status != step.want || entry.Callbacks != step.callbacks {
+					t.Errorf("%s: entry is %s after %d callbacks, want %s after %d", step.name, entry.Status, entry.Callbacks, step.want, step.callbacks)
+				}
+			}
+
+			if _, err := ledger.Record(ctx, PaymentInfo{RefId: "unknown", Status: PAYMENT_STATUS_PAID}); !errors.Is(err, ErrLedgerNotFound) {
+				t.Errorf("Record() of an unknown RefId = %v, want ErrLedgerNotFound", err)
+			}
+		})
+	}
+}
+
+func TestLedgerSetStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		from  PAYMENT_STATUS
+		to    PAYMENT_STATUS
+		err   error
+		final PAYMENT_STATUS
+	}{
+		{name: "verify pending", from: PAYMENT_STATUS_PENDING, to: PAYMENT_STATUS_VERIFIED, final: PAYMENT_STATUS_VERIFIED},
+		{name: "cancel paid", from: PAYMENT_STATUS_PAID, to: PAYMENT_STATUS_CANCELED, final: PAYMENT_STATUS_CANCELED},
+		{name: "same final status", from: PAYMENT_STATUS_VERIFIED, to: PAYMENT_STATUS_VERIFIED, final: PAYMENT_STATUS_VERIFIED},
+		{name: "cancel verified", from: PAYMENT_STATUS_VERIFIED, to: PAYMENT_STATUS_CANCELED, err: ErrPaymentFinal, final: PAYMENT_STATUS_VERIFIED},
+		{name: "verify expired", from: PAYMENT_STATUS_EXPIRED, to: PAYMENT_STATUS_VERIFIED, err: ErrPaymentFinal, final: PAYMENT_STATUS_EXPIRED},
+	}
+	for name, store := range ledgerStores(t) {
+		for _, tt := range tests {
+			t.Run(name+" "+tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				refId := name + tt.name
+				if err := store.Insert(ctx, LedgerEntry{RefId: refId, Status: tt.from}); err != nil {
+					t.Fatal(err)
+				}
+				entry, err := NewLedger(store, 0).SetStatus(ctx, refId, tt.to)
+				if !errors.Is(err, tt.err) {
+					t.Errorf("SetStatus() = %v, want %v", err, tt.err)
+				}
+				if entry.Status != tt.final {
+					t.Errorf("SetStatus() returned status %s, want %s", entry.Status, tt.final)
+				}
+				if stored, _ := store.Get(ctx, refId); stored.Status != tt.final {
+					t.Errorf("stored status = %s, want %s", stored.Status, tt.final)
+				}
+			})
+		}
+	}
+}
+
+func TestLedgerExpireStale(t *testing.T) {
+	for name, store := range ledgerStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			ledger := NewLedger(store, time.Hour)
+			past := time.Now().Add(-2 * time.Hour)
+			entries := []LedgerEntry{
+				{RefId: "stale", Status: PAYMENT_STATUS_PENDING, IssuedAt: past, ExpiresAt: past.Add(time.Hour)},
+				{RefId: "stale paid", Status: PAYMENT_STATUS_PAID, IssuedAt: past, ExpiresAt: past.Add(time.Hour)},
+				{RefId: "forever", Status: PAYMENT_STATUS_PENDING, IssuedAt: past},
+			}
+			for _, entry := range entries {
+				if err := store.Insert(ctx, entry); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := ledger.Issue(ctx, 1, payButton("fresh")); err != nil {
+				t.Fatal(err)
+			}
+
+			pending, err := ledger.Pending(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := refIds(pending); got != "forever fresh" {
+				t.Errorf("Pending() = %s, want forever fresh", got)
+			}
+			expired, err := ledger.ExpireStale(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := refIds(expired); got != "stale" {
+				t.Errorf("ExpireStale() = %s, want stale", got)
+			}
+			if entry, _ := store.Get(ctx, "stale"); entry.Status != PAYMENT_STATUS_EXPIRED {
+				t.Errorf("stale entry is %s, want expired", entry.Status)
+			}
+			if entry, _ := store.Get(ctx, "stale paid"); entry.Status != PAYMENT_STATUS_PAID {
+				t.Errorf("paid entry is %s, want it left alone", entry.Status)
+			}
+			if expired, _ := ledger.Expired(ctx); len(expired) != 0 {
+				t.Errorf("Expired() after ExpireStale = %s", refIds(expired))
+			}
+			if _, err := ledger.Record(ctx, PaymentInfo{RefId: "stale", Status: PAYMENT_STATUS_PAID}); !errors.Is(err, ErrPaymentFinal) {
+				t.Errorf("Record() after expiry = %v, want ErrPaymentFinal", err)
+			}
+		})
+	}
+}
+
+// racingLedgerStore applies the status of a competing replica just before the
+// first conditional update goes through.
+type racingLedgerStore struct {
+	LedgerStore
+	competitor PAYMENT_STATUS
+	conflicts  int
+}
+
+func (s *racingLedgerStore) UpdateIfStatus(ctx context.Context, entry LedgerEntry, status PAYMENT_STATUS) error {
+	if s.competitor != "" {
+		other, err := s.LedgerStore.Get(ctx, entry.RefId)
+		if err != nil {
+			return err
+		}
+		other.Status, s.competitor = s.competitor, ""
+		other.Callbacks++
+		if err := s.LedgerStore.Update(ctx, other); err != nil {
+			return err
+		}
+	}
+	err := s.LedgerStore.UpdateIfStatus(ctx, entry, status)
+	if errors.Is(err, ErrLedgerConflict) {
+		s.conflicts++
+	}
+	return err
+}
+
+func TestLedgerRecordRetriesOnConflict(t *testing.T) {
+	tests := []struct {
+		name       string
+		competitor PAYMENT_STATUS
+		callback   PAYMENT_STATUS
+		err        error
+		want       PAYMENT_STATUS
+	}{
+		{name: "same callback on another replica", competitor: PAYMENT_STATUS_PAID, callback: PAYMENT_STATUS_PAID, err: ErrDuplicatePayment, want: PAYMENT_STATUS_PAID},
+		{name: "expired by another replica", competitor: PAYMENT_STATUS_EXPIRED, callback: PAYMENT_STATUS_PAID, err: ErrPaymentFinal, want: PAYMENT_STATUS_EXPIRED},
+	}
+	for name := range ledgerStores(t) {
+		for _, tt := range tests {
+			t.Run(name+" "+tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				store := &racingLedgerStore{LedgerStore: ledgerStores(t)[name]}
+				ledger := NewLedger(store, 0)
+				if _, err := ledger.Issue(ctx, 1, payButton("order-1")); err != nil {
+					t.Fatal(err)
+				}
+				store.competitor = tt.competitor
+				entry, err := ledger.Record(ctx, PaymentInfo{RefId: "order-1", Status: tt.callback})
+				if !errors.Is(err, tt.err) {
+					t.Errorf("Record() = %v, want %v", err, tt.err)
+				}
+				if store.conflicts != 1 {
+					t.Errorf("%d conflicts, want 1", store.conflicts)
+				}
+				stored, _ := store.Get(ctx, "order-1")
+				if entry.Status != tt.want || stored.Status != tt.want || stored.Callbacks != 2 {
+					t.Errorf("entry %s, stored %s after %d callbacks, want %s after 2", entry.Status, stored.Status, stored.Callbacks, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func refIds(entries []LedgerEntry) string {
+	var ids string
+	for i, entry := range entries {
+		if i > 0 {
+			ids += " "
+		}
+		ids += entry.RefId
+	}
+	return ids
+}
@@ -0,0 +1,164 @@
+package gapBotApi
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultMediaRules returns the checks applied to uploads of each message type.
+func DefaultMediaRules() map[MESSAGE_TYPE]MediaRule {
+	return map[MESSAGE_TYPE]MediaRule{
+		MESSAGE_TYPE_IMAGE: {
+			Extensions: []string{".jpg", ".jpeg", ".png", ".gif", ".webp"},
+			MimeTypes:  []string{"image/jpeg", "image/png", "image/gif", "image/webp"},
+			MaxSize:    10 << 20,
+		},
+		MESSAGE_TYPE_VIDEO: {
+			Extensions: []string{".mp4", ".mov", ".m4v", ".mkv", ".webm", ".3gp"},
+			MimeTypes:  []string{"video/"},
+			MaxSize:    50 << 20,
+		},
+		MESSAGE_TYPE_VOICE: {
+			Extensions: []string{".ogg", ".oga", ".opus", ".m4a", ".mp3", ".amr"},
+			// M4A is an MP4 container, which content sniffing reports as video/mp4
+			MimeTypes: []string{"audio/", "application/ogg", "video/mp4"},
+			MaxSize:   10 << 20,
+		},
+		MESSAGE_TYPE_AUDIO: {
+			Extensions: []string{".mp3", ".m4a", ".ogg", ".oga", ".wav", ".flac", ".aac"},
+			MimeTypes:  []string{"audio/", "application/ogg", "video/mp4"},
+			MaxSize:    50 << 20,
+		},
+		MESSAGE_TYPE_STICKER: {
+			Extensions: []string{".webp", ".png"},
+			MimeTypes:  []string{"image/webp", "image/png"},
+			MaxSize:    1 << 20,
+		},
+		MESSAGE_TYPE_FILE: {
+			MaxSize: 50 << 20,
+		},
+	}
+}
+
+// SetMaxFileSize changes the size ceiling for uploads of the given message type.
+// A size of zero disables the check.
+func (bot *BotAPI) SetMaxFileSize(t MESSAGE_TYPE, size int64) {
+	if bot.MediaRules == nil {
+		bot.MediaRules = make(map[MESSAGE_TYPE]MediaRule)
+	}
+	rule := bot.MediaRules[t]
+	rule.MaxSize = size
+	bot.MediaRules[t] = rule
+}
+
+func (rule MediaRule) check(t MESSAGE_TYPE, name string, data []byte) error {
+	size := int64(len(data))
+	if size == 0 {
+		return &MediaError{Type: t, Name: name, Reason: MEDIA_ERROR_REASON_EMPTY}
+	}
+	if rule.MaxSize > 0 && size > rule.MaxSize {
+		return &MediaError{Type: t, Name: name, Reason: MEDIA_ERROR_REASON_TOO_LARGE, Size: size, MaxSize: rule.MaxSize}
+	}
+	mime := http.DetectContentType(data)
+	if len(rule.Extensions) > 0 {
+		ext := strings.ToLower(filepath.Ext(name))
+		// names without an extension, e.g. of a FileReader, are judged by their content
+		sniffed := ext == "" && len(rule.MimeTypes) > 0 && hasAnyPrefix(mime, rule.MimeTypes)
+		if !sniffed && !containsString(rule.Extensions, ext) {
+			return &MediaError{Type: t, Name: name, Reason: MEDIA_ERROR_REASON_EXTENSION, Size: size}
+		}
+	}
+	if len(rule.MimeTypes) > 0 {
+		// application/octet-stream means the content could not be sniffed,
+		// in which case the extension check above has the final word.
+		if mime != "application/octet-stream" && !hasAnyPrefix(mime, rule.MimeTypes) {
+			return &MediaError{Type: t, Name: name, Reason: MEDIA_ERROR_REASON_MIME, Size: size, MimeType: mime}
+		}
+	}
+	return nil
+}
+
+// checkMedia validates an upload against the bot's media rules. Photos in a format
+// Gap does not render as an image are sent as a plain file instead, in which case
+// the returned RequestFile and params["type"] are switched to MESSAGE_TYPE_FILE.
+func (bot *BotAPI) checkMedia(params Params, file RequestFile, name string, data []byte) (RequestFile, error) {
+	rule := bot.MediaRules[file.Type]
+	if file.MaxSize > 0 {
+		rule.MaxSize = file.MaxSize
+	}
+	err := rule.check(file.Type, name, data)
+	if err == nil {
+		return file, nil
+	}
+
+	mErr, ok := err.(*MediaError)
+	if !ok || file.Type != MESSAGE_TYPE_IMAGE ||
+		(mErr.Reason != MEDIA_ERROR_REASON_EXTENSION && mErr.Reason != MEDIA_ERROR_REASON_MIME) {
+		return file, err
+	}
+
+	file.Name = "file"
+	file.Type = MESSAGE_TYPE_FILE
+	params["type"] = string(MESSAGE_TYPE_FILE)
+	rule = bot.MediaRules[MESSAGE_TYPE_FILE]
+	if file.MaxSize > 0 {
+		rule.MaxSize = file.MaxSize
+	}
+	return file, rule.check(file.Type, name, data)
+}
+
+// readLimit is the number of bytes worth reading from an upload of the given type
+// before it is certain to be rejected. Zero means no limit.
+func (bot *BotAPI) readLimit(file RequestFile) int64 {
+	if file.MaxSize > 0 {
+		return file.MaxSize
+	}
+	limit := bot.MediaRules[file.Type].MaxSize
+	if file.Type == MESSAGE_TYPE_IMAGE {
+		fallback := bot.MediaRules[MESSAGE_TYPE_FILE].MaxSize
+		if fallback == 0 || (limit != 0 && fallback > limit) {
+			limit = fallback
+		}
+	}
+	return limit
+}
+
+// readUpload loads the content of a file that needs uploading, reading at most
+// one byte past limit so oversized files are detected without loading them fully.
+func readUpload(data RequestFileData, limit int64) (string, []byte, error) {
+	name, reader, err := data.UploadData()
+	if err != nil {
+		return "", nil, err
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if limit > 0 {
+		reader = io.LimitReader(reader, limit+1)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return "", nil, err
+	}
+	return name, content, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
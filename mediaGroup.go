@@ -0,0 +1,91 @@
+package gapBotApi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// SendMediaGroup uploads all items of the group, bounded by MaxParallelUploads, and
+// then sends them to the chat in order while no other Send can reach that chat.
+// If any item fails, the messages already sent for the group are deleted again.
+// Items must all go to the same chat, which MediaGroupConfig.ChatID sets when non-zero.
+func (bot *BotAPI) SendMediaGroup(config MediaGroupConfig) ([]Message, error) {
+	return bot.SendMediaGroupContext(context.Background(), config)
+}
+
+// SendMediaGroupContext is like SendMediaGroup but aborts the HTTP calls when ctx is done.
+// The rollback of a failed group is attempted even then.
+func (bot *BotAPI) SendMediaGroupContext(ctx context.Context, config MediaGroupConfig) ([]Message, error) {
+	if len(config.Items) == 0 {
+		return nil, errors.New("media group has no items")
+	}
+
+	params := make([]Params, len(config.Items))
+	for i, item := range config.Items {
+		p, err := item.params()
+		if err != nil {
+			return nil, fmt.Errorf("media group item %d: %w", i, err)
+		}
+		if config.ChatID != 0 {
+			p["chat_id"] = strconv.FormatInt(config.ChatID, 10)
+		}
+		// the group is sent under the lock of a single chat
+		if i > 0 && p["chat_id"] != params[0]["chat_id"] {
+			return nil, fmt.Errorf("media group item %d goes to chat %s, not %s", i, p["chat_id"], params[0]["chat_id"])
+		}
+		params[i] = p
+	}
+
+	parallel := config.MaxParallelUploads
+	if parallel <= 0 {
+		parallel = DefaultMediaGroupUploads
+	}
+	data := make([]string, len(config.Items))
+	errs := make([]error, len(config.Items))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, item := range config.Items {
+		wg.Add(1)
+		go func(i int, item Fileable) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			data[i], errs[i] = bot.fileData(ctx, params[i], item.file())
+		}(i, item)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("upload media group item %d: %w", i, err)
+		}
+	}
+
+	chatID, _ := strconv.ParseInt(params[0].GetParam("chat_id"), 10, 64)
+	defer bot.lockChat(chatID)()
+
+	messages := make([]Message, 0, len(config.Items))
+	for i, item := range config.Items {
+		params[i]["data"] = data[i]
+		resp, err := bot.post(ctx, item.method(), params[i])
+		if err != nil {
+			err = fmt.Errorf("send media group item %d: %w", i, err)
+			return nil, errors.Join(err, bot.rollback(messages))
+		}
+		messages = append(messages, sentMessage(resp, item.method(), params[i]))
+	}
+	return messages, nil
+}
+
+// rollback deletes messages that were sent as part of a group that failed.
+func (bot *BotAPI) rollback(messages []Message) error {
+	var errs []error
+	for _, msg := range messages {
+		if _, err := bot.Request(NewDeleteMessage(msg.ChatID, msg.MessageID)); err != nil {
+			errs = append(errs, fmt.Errorf("delete message %d: %w", msg.MessageID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,147 @@
+package gapBotApi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mediaGroupServer fakes the upload, sendMessage and deleteMessage calls of Gap.
+// Uploads get the file name as SID and sendMessage fails for the SIDs in failing.
+type mediaGroupServer struct {
+	mu          sync.Mutex
+	uploading   int
+	maxParallel int
+	sent        []string
+	deleted     []string
+	failing     map[string]bool
+	nextID      int
+}
+
+func (s *mediaGroupServer) serve(w http.ResponseWriter, r *http.Request) {
+	switch apiMethod(r) {
+	case "upload":
+		s.mu.Lock()
+		s.uploading++
+		if s.uploading > s.maxParallel {
+			s.maxParallel = s.uploading
+		}
+		s.mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		_, header, err := r.FormFile("image")
+		s.mu.Lock()
+		s.uploading--
+		s.mu.Unlock()
+		if err != nil {
+			fmt.Fprintf(w, `{"error":%q}`, err.Error())
+			return
+		}
+		fmt.Fprintf(w, `{"SID":%q,"type":"image"}`, strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename)))
+	case "sendMessage":
+		var file FileDta
+		json.Unmarshal([]byte(r.FormValue("data")), &file)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.failing[file.SID] {
+			fmt.Fprint(w, `{"error":"send failed"}`)
+			return
+		}
+		s.nextID++
+		s.sent = append(s.sent, file.SID)
+		fmt.Fprintf(w, `{"id":%d}`, s.nextID)
+	case "deleteMessage":
+		s.mu.Lock()
+		s.deleted = append(s.deleted, r.FormValue("chat_id")+"/"+r.FormValue("message_id"))
+		s.mu.Unlock()
+		fmt.Fprint(w, `{}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func photos(chatID int64, n int) []Fileable {
+	items := make([]Fileable, n)
+	for i := range items {
+		items[i] = NewPhoto(chatID, FileReader{Name: fmt.Sprintf("p%d.jpg", i), Reader: bytes.NewReader(jpegData)})
+	}
+	return items
+}
+
+func TestSendMediaGroup(t *testing.T) {
+	srv := &mediaGroupServer{}
+	bot := newTestBot(t, srv.serve)
+
+	config := NewMediaGroup(7, photos(0, 6)...)
+	config.MaxParallelUploads = 2
+	messages, err := bot.SendMediaGroup(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"p0", "p1", "p2", "p3", "p4", "p5"}; !reflect.DeepEqual(srv.sent, want) {
+		t.Errorf("sent %v, want %v", srv.sent, want)
+	}
+	if srv.maxParallel > 2 {
+		t.Errorf("%d uploads ran at once, want at most 2", srv.maxParallel)
+	}
+	if len(messages) != 6 {
+		t.Fatalf("got %d messages, want 6", len(messages))
+	}
+	for i, msg := range messages {
+		if msg.ChatID != 7 || msg.MessageID != int64(i+1) || msg.Photo.SID != fmt.Sprintf("p%d", i) {
+			t.Errorf("message %d = chat %d id %d photo %q", i, msg.ChatID, msg.MessageID, msg.Photo.SID)
+		}
+	}
+}
+
+func TestSendMediaGroupRollsBack(t *testing.T) {
+	srv := &mediaGroupServer{failing: map[string]bool{"p2": true}}
+	bot := newTestBot(t, srv.serve)
+
+	messages, err := bot.SendMediaGroup(NewMediaGroup(7, photos(0, 4)...))
+	if err == nil || !strings.Contains(err.Error(), "send media group item 2") {
+		t.Fatalf("SendMediaGroup() = %v, want an error for item 2", err)
+	}
+	if messages != nil {
+		t.Errorf("got messages %v for a failed group", messages)
+	}
+	if want := []string{"p0", "p1"}; !reflect.DeepEqual(srv.sent, want) {
+		t.Errorf("sent %v, want %v", srv.sent, want)
+	}
+	if want := []string{"7/1", "7/2"}; !reflect.DeepEqual(srv.deleted, want) {
+		t.Errorf("deleted %v, want %v", srv.deleted, want)
+	}
+}
+
+func TestSendMediaGroupUploadFailure(t *testing.T) {
+	srv := &mediaGroupServer{}
+	bot := newTestBot(t, srv.serve)
+
+	items := photos(7, 3)
+	items[1] = NewPhoto(7, FileReader{Name: "p1.jpg", Reader: bytes.NewReader(nil)})
+	if _, err := bot.SendMediaGroup(NewMediaGroup(0, items...)); err == nil {
+		t.Fatal("SendMediaGroup() succeeded with an empty item")
+	}
+	if len(srv.sent) != 0 || len(srv.deleted) != 0 {
+		t.Errorf("sent %v and deleted %v, want nothing sent", srv.sent, srv.deleted)
+	}
+}
+
+func TestSendMediaGroupSameChat(t *testing.T) {
+	bot := newTestBot(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected %s call", apiMethod(r))
+	})
+	items := append(photos(7, 2), photos(8, 1)...)
+	if _, err := bot.SendMediaGroup(NewMediaGroup(0, items...)); err == nil {
+		t.Error("SendMediaGroup() accepted items for two chats")
+	}
+	if _, err := bot.SendMediaGroup(NewMediaGroup(0)); err == nil {
+		t.Error("SendMediaGroup() accepted an empty group")
+	}
+}
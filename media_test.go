@@ -0,0 +1,130 @@
+package gapBotApi
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+var (
+	jpegData = []byte("\xFF\xD8\xFF\xE0\x00\x10JFIF\x00")
+	pngData  = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	textData = []byte("hello, world")
+)
+
+func TestMediaRuleCheck(t *testing.T) {
+	rules := DefaultMediaRules()
+	tests := []struct {
+		name     string
+		typ      MESSAGE_TYPE
+		fileName string
+		data     []byte
+		maxSize  int64
+		reason   MEDIA_ERROR_REASON
+	}{
+		{name: "jpeg", typ: MESSAGE_TYPE_IMAGE, fileName: "a.JPG", data: jpegData},
+		{name: "png without extension", typ: MESSAGE_TYPE_IMAGE, fileName: "upload", data: pngData},
+		{name: "png without name", typ: MESSAGE_TYPE_IMAGE, data: pngData},
+		{name: "empty", typ: MESSAGE_TYPE_IMAGE, fileName: "a.jpg", reason: MEDIA_ERROR_REASON_EMPTY},
+		{name: "too large", typ: MESSAGE_TYPE_IMAGE, fileName: "a.jpg", data: jpegData, maxSize: 4, reason: MEDIA_ERROR_REASON_TOO_LARGE},
+		{name: "extension", typ: MESSAGE_TYPE_IMAGE, fileName: "a.txt", data: jpegData, reason: MEDIA_ERROR_REASON_EXTENSION},
+		{name: "text without extension", typ: MESSAGE_TYPE_IMAGE, fileName: "upload", data: textData, reason: MEDIA_ERROR_REASON_EXTENSION},
+		{name: "mime", typ: MESSAGE_TYPE_IMAGE, fileName: "a.png", data: textData, reason: MEDIA_ERROR_REASON_MIME},
+		{name: "unsniffable content", typ: MESSAGE_TYPE_VOICE, fileName: "a.amr", data: []byte{0x01, 0x02, 0x03}},
+		{name: "any file", typ: MESSAGE_TYPE_FILE, fileName: "notes", data: textData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := rules[tt.typ]
+			if tt.maxSize > 0 {
+				rule.MaxSize = tt.maxSize
+			}
+			err := rule.check(tt.typ, tt.fileName, tt.data)
+			if tt.reason == "" {
+				if err != nil {
+					t.Errorf("check(%q) = %v", tt.fileName, err)
+				}
+				return
+			}
+			var mErr *MediaError
+			if !errors.As(err, &mErr) || mErr.Reason != tt.reason {
+				t.Errorf("check(%q) = %v, want reason %s", tt.fileName, err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestCheckMediaPhotoFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		data     []byte
+		wantType MESSAGE_TYPE
+	}{
+		{name: "photo", fileName: "a.png", data: pngData, wantType: MESSAGE_TYPE_IMAGE},
+		{name: "sniffed photo", fileName: "", data: jpegData, wantType: MESSAGE_TYPE_IMAGE},
+		{name: "unsupported extension", fileName: "a.bmp", data: []byte("BM\x00\x00"), wantType: MESSAGE_TYPE_FILE},
+		{name: "not an image", fileName: "a.jpg", data: textData, wantType: MESSAGE_TYPE_FILE},
+	}
+	bot := &BotAPI{MediaRules: DefaultMediaRules()}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := Params{"type": string(MESSAGE_TYPE_IMAGE)}
+			file, err := bot.checkMedia(params, RequestFile{Name: "image", Type: MESSAGE_TYPE_IMAGE}, tt.fileName, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if file.Type != tt.wantType || params["type"] != string(tt.wantType) || file.Name != string(tt.wantType) {
+				t.Errorf("checkMedia(%q) sends %s as field %q with type %q, want %s", tt.fileName, file.Type, file.Name, params["type"], tt.wantType)
+			}
+		})
+	}
+}
+
+func TestReadLimit(t *testing.T) {
+	rules := map[MESSAGE_TYPE]MediaRule{
+		MESSAGE_TYPE_IMAGE: {MaxSize: 10},
+		MESSAGE_TYPE_VIDEO: {MaxSize: 50},
+		MESSAGE_TYPE_FILE:  {MaxSize: 30},
+	}
+	tests := []struct {
+		name  string
+		rules map[MESSAGE_TYPE]MediaRule
+		file  RequestFile
+		want  int64
+	}{
+		{name: "rule", rules: rules, file: RequestFile{Type: MESSAGE_TYPE_VIDEO}, want: 50},
+		{name: "override", rules: rules, file: RequestFile{Type: MESSAGE_TYPE_VIDEO, MaxSize: 5}, want: 5},
+		{name: "photo read up to the file fallback", rules: rules, file: RequestFile{Type: MESSAGE_TYPE_IMAGE}, want: 30},
+		{name: "unlimited file fallback", rules: map[MESSAGE_TYPE]MediaRule{MESSAGE_TYPE_IMAGE: {MaxSize: 10}}, file: RequestFile{Type: MESSAGE_TYPE_IMAGE}, want: 0},
+		{name: "no rule", rules: rules, file: RequestFile{Type: MESSAGE_TYPE_STICKER}, want: 0},
+		{name: "no rules", file: RequestFile{Type: MESSAGE_TYPE_VIDEO}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &BotAPI{MediaRules: tt.rules}
+			if got := bot.readLimit(tt.file); got != tt.want {
+				t.Errorf("readLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadUploadStopsPastLimit(t *testing.T) {
+	data := FileReader{Name: "a.bin", Reader: bytes.NewReader(make([]byte, 100))}
+	_, content, err := readUpload(data, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(content) != 11 {
+		t.Errorf("read %d bytes, want 11", len(content))
+	}
+}
+
+func TestSetMaxFileSizeWithoutRules(t *testing.T) {
+	bot := &BotAPI{}
+	bot.SetMaxFileSize(MESSAGE_TYPE_VIDEO, 5)
+	if got := bot.MediaRules[MESSAGE_TYPE_VIDEO].MaxSize; got != 5 {
+		t.Errorf("MaxSize = %d, want 5", got)
+	}
+}
@@ -0,0 +1,137 @@
+package gapBotApi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// HandlePayment registers handlers for the pay and invoice callbacks of the given
+// RefId. Handlers registered for the empty RefId receive the callbacks no other
+// handler is registered for.
+func (bot *BotAPI) HandlePayment(refId string, handler ...Handler) {
+	bot.paymentsMu.Lock()
+	defer bot.paymentsMu.Unlock()
+	bot.payments[refId] = append(bot.payments[refId], handler...)
+}
+
+// RemovePaymentHandlers drops the handlers of a RefId, e.g. once its order is settled.
+func (bot *BotAPI) RemovePaymentHandlers(refId string) {
+	bot.paymentsMu.Lock()
+	defer bot.paymentsMu.Unlock()
+	delete(bot.payments, refId)
+}
+
+func (bot *BotAPI) paymentHandlers(refId string) []Handler {
+	bot.paymentsMu.RLock()
+	defer bot.paymentsMu.RUnlock()
+	if handlers, ok := bot.payments[refId]; ok {
+		return handlers
+	}
+	return bot.payments[""]
+}
+
+// paymentRef returns the RefId of a pay or invoice callback.
+func (message *Message) paymentRef() (string, bool) {
+	switch message.Type {
+	case MESSAGE_TYPE_PAY_CALLBACK:
+		return message.PaymentInfo.RefId, true
+	case MESSAGE_TYPE_INVOICE_CALLBACK:
+		return message.InvoiceInfo.RefId, true
+	}
+	return "", false
+}
+
+// VerifyPayment confirms a payment made with a payment button. Only a response with
+// PAYMENT_STATUS_VERIFIED confirms it, and a response without a status is an error.
+// A verified payment is recorded as PAYMENT_STATUS_VERIFIED in BotAPI.Ledger when
+// the button is in it, so later callbacks cannot change it.
+func (bot *BotAPI) VerifyPayment(chatID int64, refId string, amount int) (PaymentResult, error) {
+	result, err := bot.paymentRequest(PaymentVerifyConfig{BaseChat: BaseChat{ChatID: chatID}, RefId: refId, Amount: amount})
+	if err != nil {
+		return result, err
+	}
+	if result.Status == "" {
+		return result, fmt.Errorf("verify payment %s: response has no status", refId)
+	}
+	if result.Status != PAYMENT_STATUS_VERIFIED || bot.Ledger == nil {
+		return result, nil
+	}
+	_, err = bot.Ledger.SetStatus(context.Background(), refId, PAYMENT_STATUS_VERIFIED)
+	if err != nil && !errors.Is(err, ErrLedgerNotFound) {
+		return result, fmt.Errorf("record verified payment %s: %w", refId, err)
+	}
+	return result, nil
+}
+
+// CancelPayment declines the order of a payment button whose payment was not
+// verified, recording it as PAYMENT_STATUS_CANCELED in BotAPI.Ledger. Unverified
+// payments are never settled, so no refund is requested from Gap. Later pay
+// callbacks for the button are routed with Ctx.PaymentConflict set, and a payment
+// that is already verified is left alone with ErrPaymentFinal.
+func (bot *BotAPI) CancelPayment(refId string) (LedgerEntry, error) {
+	if bot.Ledger == nil {
+		return LedgerEntry{}, errors.New("canceling payments needs BotAPI.Ledger")
+	}
+	return bot.Ledger.SetStatus(context.Background(), refId, PAYMENT_STATUS_CANCELED)
+}
+
+// InquirePayment returns the current status of a payment made with a payment button.
+func (bot *BotAPI) InquirePayment(chatID int64, refId string) (PaymentResult, error) {
+	return bot.paymentRequest(PaymentInquiryConfig{BaseChat: BaseChat{ChatID: chatID}, RefId: refId})
+}
+
+// VerifyInvoice confirms a paid invoice.
+func (bot *BotAPI) VerifyInvoice(chatID int64, invoiceId string) (PaymentResult, error) {
+	return bot.paymentRequest(InvoiceVerifyConfig{BaseChat: BaseChat{ChatID: chatID}, InvoiceId: invoiceId})
+}
+
+// InquireInvoice returns the current status of an invoice.
+func (bot *BotAPI) InquireInvoice(chatID int64, invoiceId string) (PaymentResult, error) {
+	return bot.paymentRequest(InvoiceInquiryConfig{BaseChat: BaseChat{ChatID: chatID}, InvoiceId: invoiceId})
+}
+
+func (bot *BotAPI) paymentRequest(c Chattable) (PaymentResult, error) {
+	var result PaymentResult
+	resp, err := bot.Request(c)
+	if err != nil {
+		return result, err
+	}
+	if err := json.Unmarshal(resp.Raw, &result); err != nil {
+		return result, fmt.Errorf("unmarshal %s response: %w", c.method(), err)
+	}
+	if result.TraceId == "" {
+		result.TraceId = resp.TraceId
+	}
+	return result, nil
+}
+
+// VerifyPayment confirms the payment of the pay or invoice callback being handled.
+// Pay callbacks are verified for the amount BotAPI.Ledger issued the button with;
+// without a ledger entry use BotAPI.VerifyPayment with the amount of the order.
+func (ctx *Ctx) VerifyPayment() (PaymentResult, error) {
+	switch ctx.Message.Type {
+	case MESSAGE_TYPE_PAY_CALLBACK:
+		if ctx.Payment == nil {
+			return PaymentResult{}, fmt.Errorf("amount of payment %s is unknown", ctx.Message.PaymentInfo.RefId)
+		}
+		return ctx.bot.VerifyPayment(ctx.Message.ChatID, ctx.Message.PaymentInfo.RefId, ctx.Payment.Amount)
+	case MESSAGE_TYPE_INVOICE_CALLBACK:
+		return ctx.bot.VerifyInvoice(ctx.Message.ChatID, ctx.Message.InvoiceInfo.InvoiceId)
+	}
+	return PaymentResult{}, fmt.Errorf("%s update is not a payment callback", ctx.Message.Type)
+}
+
+// CancelPayment declines the order of the pay callback being handled, see
+// BotAPI.CancelPayment.
+func (ctx *Ctx) CancelPayment() (LedgerEntry, error) {
+	if ctx.Message.Type != MESSAGE_TYPE_PAY_CALLBACK {
+		return LedgerEntry{}, fmt.Errorf("%s update is not a pay callback", ctx.Message.Type)
+	}
+	entry, err := ctx.bot.CancelPayment(ctx.Message.PaymentInfo.RefId)
+	if err == nil {
+		ctx.Payment = &entry
+	}
+	return entry, err
+}
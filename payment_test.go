@@ -0,0 +1,240 @@
+package gapBotApi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// paymentUpdate encodes a pay or invoice callback update as Gap sends it.
+func paymentUpdate(t *testing.T, typ MESSAGE_TYPE, info interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	update, err := json.Marshal(map[string]interface{}{
+		"type":    typ,
+		"chat_id": 1,
+		"from":    User{Id: 42},
+		"data":    string(data),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return update
+}
+
+func TestVerifyPayment(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   string
+		wantStatus PAYMENT_STATUS
+		wantErr    bool
+		ledger     PAYMENT_STATUS
+	}{
+		{name: "verified", response: `{"status":"verified","trace_id":"t"}`, wantStatus: PAYMENT_STATUS_VERIFIED, ledger: PAYMENT_STATUS_VERIFIED},
+		{name: "not paid", response: `{"status":"pending"}`, wantStatus: PAYMENT_STATUS_PENDING, ledger: PAYMENT_STATUS_PENDING},
+		{name: "error status", response: `{"status":"error"}`, wantStatus: PAYMENT_STATUS_ERROR, ledger: PAYMENT_STATUS_PENDING},
+		{name: "no status", response: `{}`, wantErr: true, ledger: PAYMENT_STATUS_PENDING},
+		{name: "api error", response: `{"error":"invalid ref_id"}`, wantErr: true, ledger: PAYMENT_STATUS_PENDING},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var form url.Values
+			bot := newTestBot(t, func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				form = r.PostForm
+				form.Set("method", apiMethod(r))
+				fmt.Fprint(w, tt.response)
+			})
+			bot.Ledger = NewLedger(NewMemoryLedgerStore(), 0)
+			button := NewInlineKeyboardButtonPayment("Pay", 1000, INLINE_KEYBOARD_CURRENCY_IRR, "order-1", "Order")
+			if _, err := bot.Ledger.Issue(context.Background(), 1, button); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := bot.VerifyPayment(1, "order-1", 1000)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyPayment() = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && result.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", result.Status, tt.wantStatus)
+			}
+			if form.Get("method") != "payVerify" || form.Get("ref_id") != "order-1" || form.Get("amount") != "1000" || form.Get("chat_id") != "1" {
+				t.Errorf("sent %v", form)
+			}
+			entry, err := bot.Ledger.Store.Get(context.Background(), "order-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Status != tt.ledger {
+				t.Errorf("ledger status = %s, want %s", entry.Status, tt.ledger)
+			}
+		})
+	}
+}
+
+func TestVerifyPaymentWithoutLedgerEntry(t *testing.T) {
+	bot := newTestBot(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":"verified"}`)
+	})
+	bot.Ledger = NewLedger(NewMemoryLedgerStore(), 0)
+	if _, err := bot.VerifyPayment(1, "unknown", 10); err != nil {
+		t.Errorf("VerifyPayment() = %v for a payment the ledger does not know", err)
+	}
+}
+
+func TestInquirePayment(t *testing.T) {
+	var form url.Values
+	bot := newTestBot(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		form.Set("method", apiMethod(r))
+		fmt.Fprint(w, `{"ref_id":"order-1","status":"paid","amount":1000,"trace_id":"t1"}`)
+	})
+	result, err := bot.InquirePayment(1, "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PaymentResult{RefId: "order-1", Status: PAYMENT_STATUS_PAID, Amount: 1000, TraceId: "t1"}
+	if result != want {
+		t.Errorf("InquirePayment() = %+v, want %+v", result, want)
+	}
+	if form.Get("method") != "payInquiry" || form.Get("ref_id") != "order-1" || form.Has("amount") {
+		t.Errorf("sent %v", form)
+	}
+}
+
+func TestUnmarshalPaymentCallbacks(t *testing.T) {
+	tests := []struct {
+		typ     MESSAGE_TYPE
+		info    interface{}
+		payment PaymentInfo
+		invoice InvoiceInfo
+	}{
+		{
+			typ:     MESSAGE_TYPE_PAY_CALLBACK,
+			info:    PaymentInfo{RefId: "order-1", MessageId: "m1", Status: PAYMENT_STATUS_PAID},
+			payment: PaymentInfo{RefId: "order-1", MessageId: "m1", Status: PAYMENT_STATUS_PAID},
+		},
+		{
+			typ:     MESSAGE_TYPE_INVOICE_CALLBACK,
+			info:    InvoiceInfo{InvoiceId: "inv-1", RefId: "order-2", MessageId: "m2", Status: PAYMENT_STATUS_VERIFIED},
+			invoice: InvoiceInfo{InvoiceId: "inv-1", RefId: "order-2", MessageId: "m2", Status: PAYMENT_STATUS_VERIFIED},
+		},
+	}
+	for _, tt := range tests {
+		ctx := newTestCtx(&BotAPI{}, &Message{})
+		if err := ctx.Unmarshal(paymentUpdate(t, tt.typ, tt.info)); err != nil {
+			t.Fatal(err)
+		}
+		if ctx.Message.PaymentInfo != tt.payment || ctx.Message.InvoiceInfo != tt.invoice {
+			t.Errorf("%s unmarshalled to %+v and %+v", tt.typ, ctx.Message.PaymentInfo, ctx.Message.InvoiceInfo)
+		}
+	}
+	ctx := newTestCtx(&BotAPI{}, &Message{})
+	update := []byte(`{"type":"paycallback","chat_id":1,"data":"not json"}`)
+	if err := ctx.Unmarshal(update); err == nil {
+		t.Error("Unmarshal() accepted a pay callback with invalid data")
+	}
+}
+
+func TestPaymentHandlers(t *testing.T) {
+	bot, _ := recordingBot(t)
+	var routed []string
+	bot.Use(func(ctx *Ctx) (Message, error) {
+		routed = append(routed, "middleware")
+		return ctx.Next()
+	})
+	bot.HandlePayment("order-1", func(ctx *Ctx) (Message, error) {
+		routed = append(routed, "order-1")
+		return Message{}, nil
+	})
+	bot.HandlePayment("", func(ctx *Ctx) (Message, error) {
+		routed = append(routed, "fallback")
+		return Message{}, nil
+	})
+
+	tests := []struct {
+		name   string
+		update []byte
+		remove string
+		want   []string
+	}{
+		{name: "pay callback", update: paymentUpdate(t, MESSAGE_TYPE_PAY_CALLBACK, PaymentInfo{RefId: "order-1", Status: PAYMENT_STATUS_PAID}), want: []string{"middleware", "order-1"}},
+		{name: "invoice callback", update: paymentUpdate(t, MESSAGE_TYPE_INVOICE_CALLBACK, InvoiceInfo{RefId: "order-1", InvoiceId: "i"}), want: []string{"middleware", "order-1"}},
+		{name: "other ref", update: paymentUpdate(t, MESSAGE_TYPE_PAY_CALLBACK, PaymentInfo{RefId: "order-2", Status: PAYMENT_STATUS_PAID}), want: []string{"middleware", "fallback"}},
+		{name: "removed", update: paymentUpdate(t, MESSAGE_TYPE_PAY_CALLBACK, PaymentInfo{RefId: "order-1", Status: PAYMENT_STATUS_PAID}), remove: "order-1", want: []string{"middleware", "fallback"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routed = nil
+			if tt.remove != "" {
+				bot.RemovePaymentHandlers(tt.remove)
+			}
+			if _, err := bot.HandleUpdates(tt.update); err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(routed) != fmt.Sprint(tt.want) {
+				t.Errorf("routed through %v, want %v", routed, tt.want)
+			}
+		})
+	}
+	if stack := bot.userStats[42].Stack; len(stack) != 0 {
+		t.Errorf("payments were pushed on the back stack: %+v", stack)
+	}
+}
+
+func TestPaymentCallbackFollowsNextState(t *testing.T) {
+	bot, _ := recordingBot(t)
+	var ran bool
+	bot.Handle("/confirm", func(ctx *Ctx) (Message, error) {
+		ran = true
+		if ctx.UserState.Next == nil || ctx.Params["order"] != "1" {
+			t.Errorf("handler got user state %+v and params %v", ctx.UserState, ctx.Params)
+		}
+		return Message{}, nil
+	})
+	bot.userStats[42] = UserState{Next: &State{Endpoint: "/confirm", Params: map[string]interface{}{"order": "1"}}}
+	update := paymentUpdate(t, MESSAGE_TYPE_PAY_CALLBACK, PaymentInfo{RefId: "order-1", Status: PAYMENT_STATUS_PAID})
+	if _, err := bot.HandleUpdates(update); err != nil {
+		t.Fatal(err)
+	}
+	if !ran {
+		t.Error("a pay callback without payment handlers skipped the next state")
+	}
+}
+
+func TestCancelPayment(t *testing.T) {
+	bot, _ := recordingBot(t)
+	if _, err := bot.CancelPayment("order-1"); err == nil {
+		t.Error("CancelPayment() succeeded without a ledger")
+	}
+	bot.Ledger = NewLedger(NewMemoryLedgerStore(), 0)
+	button := NewInlineKeyboardButtonPayment("Pay", 1000, INLINE_KEYBOARD_CURRENCY_IRR, "order-1", "Order")
+	if _, err := bot.Ledger.Issue(context.Background(), 1, button); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := bot.CancelPayment("order-1")
+	if err != nil || entry.Status != PAYMENT_STATUS_CANCELED {
+		t.Fatalf("CancelPayment() = %+v, %v", entry, err)
+	}
+
+	var conflict error
+	bot.HandlePayment("order-1", func(ctx *Ctx) (Message, error) {
+		conflict = ctx.PaymentConflict
+		return Message{}, nil
+	})
+	update := paymentUpdate(t, MESSAGE_TYPE_PAY_CALLBACK, PaymentInfo{RefId: "order-1", Status: PAYMENT_STATUS_PAID})
+	if _, err := bot.HandleUpdates(update); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(conflict, ErrPaymentFinal) {
+		t.Errorf("PaymentConflict = %v, want ErrPaymentFinal", conflict)
+	}
+}
@@ -0,0 +1,274 @@
+package persian
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var MonthNames = [12]string{
+	"فروردین", "اردیبهشت", "خرداد", "تیر", "مرداد", "شهریور",
+	"مهر", "آبان", "آذر", "دی", "بهمن", "اسفند",
+}
+
+// WeekdayNames are indexed by time.Weekday, Sunday first.
+var WeekdayNames = [7]string{
+	"یکشنبه", "دوشنبه", "سه‌شنبه", "چهارشنبه", "پنجشنبه", "جمعه", "شنبه",
+}
+
+// jalaliBreaks are the years in which the 33 year leap cycle of the Jalali calendar shifts.
+var jalaliBreaks = []int{
+	-61, 9, 38, 199, 426, 686, 756, 818, 1111, 1181, 1210,
+	1635, 2060, 2097, 2192, 2262, 2324, 2394, 2456, 3178,
+}
+
+// jalCal returns how many years have passed since the last leap year (0 for a
+// leap year), the Gregorian year in which the Jalali year starts and the day of
+// March on which it starts.
+func jalCal(jy int) (leap, gy, march int) {
+	gy = jy + 621
+	leapJ := -14
+	jp := jalaliBreaks[0]
+	jump := 0
+	for _, jm := range jalaliBreaks[1:] {
+		jump = jm - jp
+		if jy < jm {
+			break
+		}
+		leapJ += jump/33*8 + jump%33/4
+		jp = jm
+	}
+	n := jy - jp
+	leapJ += n/33*8 + (n%33+3)/4
+	if jump%33 == 4 && jump-n == 4 {
+		leapJ++
+	}
+	leapG := gy/4 - (gy/100+1)*3/4 - 150
+	march = 20 + leapJ - leapG
+
+	if jump-n < 6 {
+		n = n - jump + (jump+4)/33*33
+	}
+	leap = ((n+1)%33 - 1) % 4
+	if leap == -1 {
+		leap = 4
+	}
+	return leap, gy, march
+}
+
+// g2d converts a Gregorian date to a Julian day number.
+func g2d(gy, gm, gd int) int {
+	d := (gy+(gm-8)/6+100100)*1461/4 + (153*((gm+9)%12)+2)/5 + gd - 34840408
+	return d - (gy+100100+(gm-8)/6)/100*3/4 + 752
+}
+
+// d2g converts a Julian day number to a Gregorian date.
+func d2g(jdn int) (gy, gm, gd int) {
+	j := 4*jdn + 139361631
+	j += (4*jdn+183187720)/146097*3/4*4 - 3908
+	i := j%1461/4*5 + 308
+	gd = i%153/5 + 1
+	gm = i/153%12 + 1
+	gy = j/1461 - 100100 + (8-gm)/6
+	return gy, gm, gd
+}
+
+func j2d(jy, jm, jd int) int {
+	_, gy, march := jalCal(jy)
+	return g2d(gy, 3, march) + (jm-1)*31 - jm/7*(jm-7) + jd - 1
+}
+
+func d2j(jdn int) (jy, jm, jd int) {
+	gy, _, _ := d2g(jdn)
+	jy = gy - 621
+	leap, _, march := jalCal(jy)
+	k := jdn - g2d(gy, 3, march)
+	if k >= 0 {
+		if k <= 185 {
+			return jy, 1 + k/31, k%31 + 1
+		}
+		k -= 186
+	} else {
+		jy--
+		k += 179
+		if leap == 1 {
+			k++
+		}
+	}
+	return jy, 7 + k/30, k%30 + 1
+}
+
+// ToJalali returns the Jalali date of t in t's location.
+func ToJalali(t time.Time) (year, month, day int) {
+	return d2j(g2d(t.Year(), int(t.Month()), t.Day()))
+}
+
+// Date is like time.Date but takes a Jalali year, month and day.
+func Date(year, month, day, hour, min, sec, nsec int, loc *time.Location) time.Time {
+	gy, gm, gd := d2g(j2d(year, month, day))
+	return time.Date(gy, time.Month(gm), gd, hour, min, sec, nsec, loc)
+}
+
+// IsLeapYear reports whether a Jalali year has 366 days.
+func IsLeapYear(year int) bool {
+	leap, _, _ := jalCal(year)
+	return leap == 0
+}
+
+// MonthDays returns the number of days in a month of a Jalali year.
+func MonthDays(year, month int) int {
+	switch {
+	case month <= 6:
+		return 31
+	case month <= 11:
+		return 30
+	case IsLeapYear(year):
+		return 30
+	}
+	return 29
+}
+
+// layoutTokens are the elements of a layout, longest first so that "2006" is
+// not read as "2" followed by "006". They follow the reference time of package time.
+var layoutTokens = []string{"2006", "January", "Monday", "15", "01", "02", "03", "04", "05", "06", "PM", "1", "2", "3"}
+
+func nextToken(layout string) (literal, token, rest string) {
+	for i := 0; i < len(layout); i++ {
+		for _, t := range layoutTokens {
+			if strings.HasPrefix(layout[i:], t) {
+				return layout[:i], t, layout[i+len(t):]
+			}
+		}
+	}
+	return layout, "", ""
+}
+
+// Format returns t as a Jalali date laid out like the reference time of package
+// time, e.g. "Monday 2 January 2006 15:04". Month and weekday names are Persian,
+// digits are Latin; pass the result to ToPersianDigits for Persian digits.
+func Format(t time.Time, layout string) string {
+	year, month, day := ToJalali(t)
+	b := &strings.Builder{}
+	for layout != "" {
+		literal, token, rest := nextToken(layout)
+		b.WriteString(literal)
+		switch token {
+		case "2006":
+			b.WriteString(strconv.Itoa(year))
+		case "06":
+			fmt.Fprintf(b, "%02d", year%100)
+		case "January":
+			b.WriteString(MonthNames[month-1])
+		case "01":
+			fmt.Fprintf(b, "%02d", month)
+		case "1":
+			b.WriteString(strconv.Itoa(month))
+		case "02":
+			fmt.Fprintf(b, "%02d", day)
+		case "2":
+			b.WriteString(strconv.Itoa(day))
+		case "Monday":
+			b.WriteString(WeekdayNames[t.Weekday()])
+		case "15":
+			fmt.Fprintf(b, "%02d", t.Hour())
+		case "03":
+			fmt.Fprintf(b, "%02d", hour12(t.Hour()))
+		case "3":
+			b.WriteString(strconv.Itoa(hour12(t.Hour())))
+		case "04":
+			fmt.Fprintf(b, "%02d", t.Minute())
+		case "05":
+			fmt.Fprintf(b, "%02d", t.Second())
+		case "PM":
+			if t.Hour() < 12 {
+				b.WriteString("ق.ظ")
+			} else {
+				b.WriteString("ب.ظ")
+			}
+		}
+		layout = rest
+	}
+	return b.String()
+}
+
+func hour12(hour int) int {
+	if hour%12 == 0 {
+		return 12
+	}
+	return hour % 12
+}
+
+// Parse parses a Jalali date laid out like Format does, e.g. Parse("2006/01/02",
+// "1403/12/30", loc). Persian and Arabic digits are accepted. Weekdays, two digit
+// years and 12 hour clocks are not supported.
+func Parse(layout, value string, loc *time.Location) (time.Time, error) {
+	original, originalLayout := value, layout
+	value = ToEnglishDigits(value)
+	year, month, day := 0, 1, 1
+	hour, min, sec := 0, 0, 0
+	for layout != "" {
+		literal, token, rest := nextToken(layout)
+		if !strings.HasPrefix(value, literal) {
+			return time.Time{}, fmt.Errorf("parse %q as %q: expected %q", original, originalLayout, literal)
+		}
+		value = value[len(literal):]
+		var err error
+		switch token {
+		case "":
+		case "2006":
+			year, value, err = parseNumber(value, 4, 4)
+		case "January":
+			month, value, err = parseMonthName(value)
+		case "01":
+			month, value, err = parseNumber(value, 2, 2)
+		case "1":
+			month, value, err = parseNumber(value, 1, 2)
+		case "02":
+			day, value, err = parseNumber(value, 2, 2)
+		case "2":
+			day, value, err = parseNumber(value, 1, 2)
+		case "15":
+			hour, value, err = parseNumber(value, 2, 2)
+		case "04":
+			min, value, err = parseNumber(value, 2, 2)
+		case "05":
+			sec, value, err = parseNumber(value, 2, 2)
+		default:
+			err = fmt.Errorf("layout element %q is not supported", token)
+		}
+		if err != nil {
+			return time.Time{}, fmt.Errorf("parse %q as %q: %w", original, originalLayout, err)
+		}
+		layout = rest
+	}
+	if value != "" {
+		return time.Time{}, fmt.Errorf("parse %q as %q: extra text %q", original, originalLayout, value)
+	}
+	if month < 1 || month > 12 || day < 1 || day > MonthDays(year, month) ||
+		hour > 23 || min > 59 || sec > 59 {
+		return time.Time{}, fmt.Errorf("parse %q: date out of range", original)
+	}
+	return Date(year, month, day, hour, min, sec, 0, loc), nil
+}
+
+func parseNumber(value string, min, max int) (int, string, error) {
+	n := 0
+	for n < max && n < len(value) && value[n] >= '0' && value[n] <= '9' {
+		n++
+	}
+	if n < min {
+		return 0, value, fmt.Errorf("expected a number at %q", value)
+	}
+	v, err := strconv.Atoi(value[:n])
+	return v, value[n:], err
+}
+
+func parseMonthName(value string) (int, string, error) {
+	for i, name := range MonthNames {
+		if strings.HasPrefix(value, name) {
+			return i + 1, value[len(name):], nil
+		}
+	}
+	return 0, value, fmt.Errorf("expected a month name at %q", value)
+}
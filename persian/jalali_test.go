@@ -0,0 +1,172 @@
+package persian
+
+import (
+	"testing"
+	"time"
+)
+
+func TestToJalali(t *testing.T) {
+	tests := []struct {
+		gregorian        string
+		year, month, day int
+	}{
+		{"1979-02-11", 1357, 11, 22},
+		{"2020-03-20", 1399, 1, 1},
+		{"2021-03-20", 1399, 12, 30},
+		{"2021-03-21", 1400, 1, 1},
+		{"2024-03-19", 1402, 12, 29},
+		{"2024-03-20", 1403, 1, 1},
+		{"2024-09-21", 1403, 6, 31},
+		{"2024-09-22", 1403, 7, 1},
+		{"2025-03-20", 1403, 12, 30},
+		{"2025-03-21", 1404, 1, 1},
+		{"2026-01-01", 1404, 10, 11},
+	}
+	for _, tt := range tests {
+		g, err := time.Parse("2006-01-02", tt.gregorian)
+		if err != nil {
+			t.Fatal(err)
+		}
+		year, month, day := ToJalali(g)
+		if year != tt.year || month != tt.month || day != tt.day {
+			t.Errorf("ToJalali(%s) = %d/%d/%d, want %d/%d/%d", tt.gregorian, year, month, day, tt.year, tt.month, tt.day)
+		}
+		if got := Date(tt.year, tt.month, tt.day, 0, 0, 0, 0, time.UTC); !got.Equal(g) {
+			t.Errorf("Date(%d, %d, %d) = %s, want %s", tt.year, tt.month, tt.day, got.Format("2006-01-02"), tt.gregorian)
+		}
+	}
+}
+
+func TestToJalaliRoundTrip(t *testing.T) {
+	start := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+	for d := start; d.Year() < 2060; d = d.AddDate(0, 0, 1) {
+		year, month, day := ToJalali(d)
+		if day < 1 || day > MonthDays(year, month) {
+			t.Fatalf("ToJalali(%s) = %d/%d/%d, which does not exist", d.Format("2006-01-02"), year, month, day)
+		}
+		if got := Date(year, month, day, 0, 0, 0, 0, time.UTC); !got.Equal(d) {
+			t.Fatalf("Date(ToJalali(%s)) = %s", d.Format("2006-01-02"), got.Format("2006-01-02"))
+		}
+	}
+}
+
+func TestIsLeapYear(t *testing.T) {
+	tests := []struct {
+		year int
+		leap bool
+	}{
+		{1370, true},
+		{1375, true},
+		{1391, true},
+		{1395, true},
+		{1398, false},
+		{1399, true},
+		{1400, false},
+		{1402, false},
+		{1403, true},
+		{1404, false},
+		{1407, false},
+		{1408, true},
+	}
+	for _, tt := range tests {
+		if got := IsLeapYear(tt.year); got != tt.leap {
+			t.Errorf("IsLeapYear(%d) = %v, want %v", tt.year, got, tt.leap)
+		}
+	}
+}
+
+func TestMonthDays(t *testing.T) {
+	tests := []struct {
+		year, month, days int
+	}{
+		{1403, 1, 31},
+		{1403, 6, 31},
+		{1403, 7, 30},
+		{1403, 11, 30},
+		{1403, 12, 30},
+		{1399, 12, 30},
+		{1402, 12, 29},
+		{1404, 12, 29},
+	}
+	for _, tt := range tests {
+		if got := MonthDays(tt.year, tt.month); got != tt.days {
+			t.Errorf("MonthDays(%d, %d) = %d, want %d", tt.year, tt.month, got, tt.days)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	// 2024-03-20 is a Wednesday, Nowruz 1403
+	moment := time.Date(2024, 3, 20, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		layout, want string
+	}{
+		{"2006/01/02", "1403/01/01"},
+		{"06-1-2", "03-1-1"},
+		{"2 January 2006", "1 فروردین 1403"},
+		{"Monday 2 January", "چهارشنبه 1 فروردین"},
+		{"15:04:05", "15:04:05"},
+		{"3:04 PM", "3:04 ب.ظ"},
+		{"03 PM", "03 ب.ظ"},
+		{"no tokens", "no tokens"},
+	}
+	for _, tt := range tests {
+		if got := Format(moment, tt.layout); got != tt.want {
+			t.Errorf("Format(%q) = %q, want %q", tt.layout, got, tt.want)
+		}
+	}
+	if got := Format(time.Date(2024, 3, 20, 0, 30, 0, 0, time.UTC), "3 PM"); got != "12 ق.ظ" {
+		t.Errorf("Format of 00:30 = %q, want %q", got, "12 ق.ظ")
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		layout, value string
+		want          time.Time
+		wantErr       bool
+	}{
+		{"2006/01/02", "1403/01/01", time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC), false},
+		{"2006/01/02", "1403/12/30", time.Date(2025, 3, 20, 0, 0, 0, 0, time.UTC), false},
+		{"2006/01/02", "1399/12/30", time.Date(2021, 3, 20, 0, 0, 0, 0, time.UTC), false},
+		{"2006/01/02", "۱۴۰۳/۱۲/۳۰", time.Date(2025, 3, 20, 0, 0, 0, 0, time.UTC), false},
+		{"2006/01/02", "١٤٠٣/١٢/٣٠", time.Date(2025, 3, 20, 0, 0, 0, 0, time.UTC), false},
+		{"2006/1/2", "1403/7/1", time.Date(2024, 9, 22, 0, 0, 0, 0, time.UTC), false},
+		{"2 January 2006", "30 اسفند 1403", time.Date(2025, 3, 20, 0, 0, 0, 0, time.UTC), false},
+		{"2006/01/02 15:04:05", "1403/01/01 15:04:05", time.Date(2024, 3, 20, 15, 4, 5, 0, time.UTC), false},
+		{"2006/01/02", "1402/12/30", time.Time{}, true},
+		{"2006/01/02", "1404/12/30", time.Time{}, true},
+		{"2006/01/02", "1403/07/31", time.Time{}, true},
+		{"2006/01/02", "1403/13/01", time.Time{}, true},
+		{"2006/01/02", "1403/00/01", time.Time{}, true},
+		{"2006/01/02", "1403-01-01", time.Time{}, true},
+		{"2006/01/02", "1403/01/01 extra", time.Time{}, true},
+		{"2006/01/02", "14/01/01", time.Time{}, true},
+		{"2 January 2006", "1 January 1403", time.Time{}, true},
+		{"2006/01/02 15:04", "1403/01/01 24:00", time.Time{}, true},
+		{"Monday 2006/01/02", "چهارشنبه 1403/01/01", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.layout, tt.value, time.UTC)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q, %q) error = %v, want error %v", tt.layout, tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !got.Equal(tt.want) {
+			t.Errorf("Parse(%q, %q) = %s, want %s", tt.layout, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseFormatRoundTrip(t *testing.T) {
+	const layout = "2006/01/02 15:04:05"
+	tehran := time.FixedZone("IRST", 3*3600+1800)
+	moment := time.Date(2025, 3, 20, 23, 59, 59, 0, tehran)
+	got, err := Parse(layout, Format(moment, layout), tehran)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(moment) {
+		t.Errorf("Parse(Format(%s)) = %s", moment, got)
+	}
+}
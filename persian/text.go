@@ -0,0 +1,121 @@
+// Package persian holds helpers for bots that talk Persian: Jalali dates, Persian
+// digits, bidirectional text marks and normalization of Arabic characters.
+package persian
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// RLM is the right-to-left mark.
+	RLM = "\u200F"
+	// LRM is the left-to-right mark.
+	LRM = "\u200E"
+)
+
+// ToPersianDigits replaces Latin and Arabic digits with Persian ones.
+func ToPersianDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9':
+			return '۰' + r - '0'
+		case r >= '٠' && r <= '٩':
+			return '۰' + r - '٠'
+		}
+		return r
+	}, s)
+}
+
+// ToEnglishDigits replaces Persian and Arabic digits with Latin ones.
+func ToEnglishDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '۰' && r <= '۹':
+			return '0' + r - '۰'
+		case r >= '٠' && r <= '٩':
+			return '0' + r - '٠'
+		}
+		return r
+	}, s)
+}
+
+// Normalize replaces the Arabic forms of letters that Arabic keyboards produce with
+// their Persian forms, Persian and Arabic digits with Latin ones, and drops tatweels
+// and diacritics, so that text typed on any keyboard compares equal and numbers in
+// commands parse with strconv. It fits BotAPI.TextNormalizer; use ToPersianDigits to
+// show numbers back to the user.
+func Normalize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == 'ي' || r == 'ى':
+			return 'ی'
+		case r == 'ك':
+			return 'ک'
+		case r == 'ة':
+			return 'ه'
+		case r >= '۰' && r <= '۹':
+			return '0' + r - '۰'
+		case r >= '٠' && r <= '٩':
+			return '0' + r - '٠'
+		case r == '\u0640' || (r >= '\u064B' && r <= '\u065F') || r == '\u0670':
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// RTL starts every line of s with a right-to-left mark, so lines that begin with
+// a Latin word or a number are still laid out right to left.
+func RTL(s string) string {
+	return RLM + strings.ReplaceAll(s, "\n", "\n"+RLM)
+}
+
+// LTR wraps s in left-to-right marks, to embed a Latin word, number or link in
+// right-to-left text without its punctuation moving around.
+func LTR(s string) string {
+	return LRM + s + LRM
+}
+
+// FixDirection lays out text that mixes Persian with Latin words and numbers: lines
+// are made right to left and every Latin word is wrapped with LTR. Text without
+// right-to-left letters is returned unchanged.
+func FixDirection(s string) string {
+	if strings.IndexFunc(s, isRTL) < 0 {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		words := strings.Split(line, " ")
+		for j, word := range words {
+			words[j] = fixWord(word)
+		}
+		lines[i] = strings.Join(words, " ")
+	}
+	return RTL(strings.Join(lines, "\n"))
+}
+
+// fixWord wraps the Latin part of a word, leaving the surrounding punctuation of
+// the sentence outside the marks.
+func fixWord(word string) string {
+	if strings.IndexFunc(word, isRTL) >= 0 {
+		return word
+	}
+	start := strings.IndexFunc(word, isLTR)
+	if start < 0 {
+		return word
+	}
+	end := strings.LastIndexFunc(word, isLTR)
+	_, size := utf8.DecodeRuneInString(word[end:])
+	end += size
+	return word[:start] + LTR(word[start:end]) + word[end:]
+}
+
+func isRTL(r rune) bool {
+	return unicode.In(r, unicode.Arabic, unicode.Hebrew) && unicode.IsLetter(r)
+}
+
+func isLTR(r rune) bool {
+	return (unicode.IsLetter(r) && !isRTL(r)) || (r >= '0' && r <= '9')
+}
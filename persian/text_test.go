@@ -0,0 +1,76 @@
+package persian
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestDigits(t *testing.T) {
+	if got := ToPersianDigits("12 ٣٤ ۵۶"); got != "۱۲ ۳۴ ۵۶" {
+		t.Errorf("ToPersianDigits() = %q", got)
+	}
+	if got := ToEnglishDigits("12 ٣٤ ۵۶"); got != "12 34 56" {
+		t.Errorf("ToEnglishDigits() = %q", got)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "arabic yeh and kaf", in: "كيف", want: "کیف"},
+		{name: "alef maksura", in: "مصطفى", want: "مصطفی"},
+		{name: "teh marbuta", in: "مدرسة", want: "مدرسه"},
+		{name: "tatweel and diacritics", in: "مـــحَمَّد", want: "محمد"},
+		{name: "persian digits", in: "/order ۱۲۳", want: "/order 123"},
+		{name: "arabic digits", in: "/order ١٢٣", want: "/order 123"},
+		{name: "persian text", in: "سلام دنیا", want: "سلام دنیا"},
+		{name: "latin text", in: "Hello 42", want: "Hello 42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Normalize(tt.in); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+	// numbers typed on any keyboard route the same
+	for _, typed := range []string{"42", "۴۲", "٤٢"} {
+		if n, err := strconv.Atoi(Normalize(typed)); err != nil || n != 42 {
+			t.Errorf("Atoi(Normalize(%q)) = %d, %v", typed, n, err)
+		}
+	}
+}
+
+func TestRTLAndLTR(t *testing.T) {
+	if got := RTL("Go\n۱۲ سلام"); got != RLM+"Go\n"+RLM+"۱۲ سلام" {
+		t.Errorf("RTL() = %q", got)
+	}
+	if got := LTR("v1.2"); got != LRM+"v1.2"+LRM {
+		t.Errorf("LTR() = %q", got)
+	}
+}
+
+func TestFixDirection(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "latin only", in: "Hello world", want: "Hello world"},
+		{name: "persian only", in: "سلام دنیا", want: RLM + "سلام دنیا"},
+		{name: "latin word", in: "نسخه Go جدید", want: RLM + "نسخه " + LRM + "Go" + LRM + " جدید"},
+		{name: "punctuation stays outside", in: "نسخه (v1.2).", want: RLM + "نسخه (" + LRM + "v1.2" + LRM + ")."},
+		{name: "number", in: "کد 123", want: RLM + "کد " + LRM + "123" + LRM},
+		{name: "lines", in: "سلام\nGo", want: RLM + "سلام\n" + RLM + LRM + "Go" + LRM},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FixDirection(tt.in); got != tt.want {
+				t.Errorf("FixDirection(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
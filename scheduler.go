@@ -0,0 +1,551 @@
+package gapBotApi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrJobNotFound      = errors.New("scheduled job not found")
+	ErrSchedulerRunning = errors.New("scheduler is already running")
+)
+
+const (
+	DefaultJobAttempts = 3
+	DefaultRetryDelay  = time.Minute
+	// MaxRetryDelay caps the doubling of the wait between retries.
+	MaxRetryDelay = 24 * time.Hour
+)
+
+// Job is a request scheduled for later delivery. Its params are built when the job
+// is scheduled, so files are uploaded once and the job survives restarts as plain data.
+type Job struct {
+	ID     string    `json:"id"`
+	ChatID int64     `json:"chat_id"`
+	Method string    `json:"method"`
+	Params Params    `json:"params"`
+	RunAt  time.Time `json:"run_at"`
+	// Cron is the spec of a recurring job and empty for a one-off job.
+	Cron string `json:"cron,omitempty"`
+	// Attempts counts the failed deliveries of the current run.
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// JobStore persists scheduled jobs.
+type JobStore interface {
+	// Save adds a job or replaces the job with the same ID.
+	Save(ctx context.Context, job Job) error
+	// Delete removes a job or returns ErrJobNotFound.
+	Delete(ctx context.Context, id string) error
+	// List returns every stored job.
+	List(ctx context.Context) ([]Job, error)
+}
+
+// preparedRequest is a Chattable whose method and params were built beforehand.
+type preparedRequest struct {
+	Method string
+	Params Params
+}
+
+func (r preparedRequest) params() (Params, error) {
+	return copyParams(r.Params), nil
+}
+
+func (r preparedRequest) method() string {
+	return r.Method
+}
+
+// Scheduler delivers Chattables at a given time or on a cron schedule. Jobs are
+// kept in a JobStore and reloaded on first use, so pending jobs survive restarts and
+// can be listed and cancelled before Start.
+type Scheduler struct {
+	bot   *BotAPI
+	Store JobStore
+	// MaxAttempts is how many times a delivery is tried before it is given up.
+	MaxAttempts int
+	// RetryDelay is the wait before the first retry. It doubles on each retry up to
+	// MaxRetryDelay. Zero means DefaultRetryDelay.
+	RetryDelay time.Duration
+	// Location is the time zone cron specs are evaluated in. Defaults to time.Local.
+	Location *time.Location
+	// OnError is called when a delivery is given up after MaxAttempts.
+	OnError func(job Job, err error)
+	mu      sync.Mutex
+	jobs    map[string]Job
+	wake    chan struct{}
+	running bool
+	loadMu  sync.Mutex
+	loaded  bool
+}
+
+// NewScheduler creates a scheduler that sends through bot and sets it as
+// bot.Scheduler.
+func NewScheduler(bot *BotAPI, store JobStore) *Scheduler {
+	s := &Scheduler{
+		bot:         bot,
+		Store:       store,
+		MaxAttempts: DefaultJobAttempts,
+		RetryDelay:  DefaultRetryDelay,
+		Location:    time.Local,
+		jobs:        make(map[string]Job),
+		wake:        make(chan struct{}, 1),
+	}
+	bot.Scheduler = s
+	return s
+}
+
+// Start loads the stored jobs and delivers them in the background until ctx is done.
+// Jobs that came due while the bot was down are delivered right away. It returns
+// ErrSchedulerRunning if the scheduler is already started and ctx of that start is
+// not done yet.
+func (s *Scheduler) Start(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return ErrSchedulerRunning
+	}
+	s.running = true
+	s.mu.Unlock()
+
+	if err := s.load(ctx); err != nil {
+		s.stop()
+		return err
+	}
+	go s.run(ctx)
+	return nil
+}
+
+// At schedules c for delivery at t.
+func (s *Scheduler) At(t time.Time, c Chattable) (Job, error) {
+	return s.schedule(t, "", c)
+}
+
+// After schedules c for delivery once d has passed.
+func (s *Scheduler) After(d time.Duration, c Chattable) (Job, error) {
+	return s.schedule(time.Now().Add(d), "", c)
+}
+
+// Cron schedules c for delivery on every match of a five field cron spec such as
+// "30 9 * * 1-5", or a descriptor such as "@daily".
+func (s *Scheduler) Cron(spec string, c Chattable) (Job, error) {
+	schedule, err := parseCron(spec)
+	if err != nil {
+		return Job{}, err
+	}
+	next := schedule.next(time.Now().In(s.location()))
+	if next.IsZero() {
+		return Job{}, errors.New("cron spec " + strconv.Quote(spec) + " never matches")
+	}
+	return s.schedule(next, spec, c)
+}
+
+func (s *Scheduler) schedule(t time.Time, spec string, c Chattable) (Job, error) {
+	ctx := context.Background()
+	if err := s.load(ctx); err != nil {
+		return Job{}, err
+	}
+	params, err := s.bot.prepare(ctx, c)
+	if err != nil {
+		return Job{}, err
+	}
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+	chatID, _ := strconv.ParseInt(params.GetParam("chat_id"), 10, 64)
+	job := Job{
+		ID:        id,
+		ChatID:    chatID,
+		Method:    c.method(),
+		Params:    params,
+		RunAt:     t,
+		Cron:      spec,
+		CreatedAt: time.Now(),
+	}
+	if err := s.Store.Save(ctx, job); err != nil {
+		return Job{}, err
+	}
+
+	s.mu.Lock()
+	s.jobs[job.ID] = job
+	s.mu.Unlock()
+	s.notify()
+	return job, nil
+}
+
+// Cancel removes a pending job.
+func (s *Scheduler) Cancel(id string) error {
+	if err := s.load(context.Background()); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	_, ok := s.jobs[id]
+	delete(s.jobs, id)
+	s.mu.Unlock()
+	if !ok {
+		return ErrJobNotFound
+	}
+	return s.Store.Delete(context.Background(), id)
+}
+
+// List returns the pending jobs of a chat, soonest first. A chatID of zero lists
+// the jobs of every chat. Only the jobs scheduled since the bot started are listed
+// when the stored jobs cannot be loaded.
+func (s *Scheduler) List(chatID int64) []Job {
+	if err := s.load(context.Background()); err != nil && s.bot.Debug {
+		log.Printf("load scheduled jobs: %s\n", err)
+	}
+	s.mu.Lock()
+	var jobs []Job
+	for _, job := range s.jobs {
+		if chatID == 0 || job.ChatID == chatID {
+			jobs = append(jobs, job)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].RunAt.Before(jobs[j].RunAt)
+	})
+	return jobs
+}
+
+// load reads the stored jobs the first time they are needed. It is retried on the
+// next use when the store fails.
+func (s *Scheduler) load(ctx context.Context) error {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+	if s.loaded {
+		return nil
+	}
+	jobs, err := s.Store.List(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	for _, job := range jobs {
+		s.jobs[job.ID] = job
+	}
+	s.mu.Unlock()
+	s.loaded = true
+	return nil
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) location() *time.Location {
+	if s.Location == nil {
+		return time.Local
+	}
+	return s.Location
+}
+
+func (s *Scheduler) stop() {
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+}
+
+func (s *Scheduler) run(ctx context.Context) {
+	defer s.stop()
+	for {
+		wait := time.Hour
+		if next := s.runDue(ctx); !next.IsZero() {
+			wait = time.Until(next)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// runDue delivers the jobs that are due and returns when the next one is.
+func (s *Scheduler) runDue(ctx context.Context) time.Time {
+	now := time.Now()
+	var due []Job
+	s.mu.Lock()
+	for _, job := range s.jobs {
+		if !job.RunAt.After(now) {
+			due = append(due, job)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].RunAt.Before(due[j].RunAt)
+	})
+
+	for _, job := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		_, err := s.bot.SendContext(ctx, preparedRequest{Method: job.Method, Params: job.Params})
+		s.finish(ctx, job, err)
+	}
+
+	var next time.Time
+	s.mu.Lock()
+	for _, job := range s.jobs {
+		if next.IsZero() || job.RunAt.Before(next) {
+			next = job.RunAt
+		}
+	}
+	s.mu.Unlock()
+	return next
+}
+
+// finish reschedules, retries or removes a job after a delivery attempt.
+func (s *Scheduler) finish(ctx context.Context, job Job, err error) {
+	remove := false
+	if err == nil {
+		job.Attempts, job.LastError = 0, ""
+		remove = !s.advance(&job)
+	} else {
+		job.Attempts++
+		job.LastError = err.Error()
+		if job.Attempts < s.maxAttempts() {
+			job.RunAt = time.Now().Add(s.backoff(job.Attempts))
+		} else {
+			if s.OnError != nil {
+				s.OnError(job, err)
+			} else if s.bot.Debug {
+				log.Printf("scheduled job %s failed after %d attempts: %s\n", job.ID, job.Attempts, err)
+			}
+			job.Attempts = 0
+			remove = !s.advance(&job)
+		}
+	}
+
+	s.mu.Lock()
+	if _, ok := s.jobs[job.ID]; !ok {
+		// cancelled while it was being delivered
+		s.mu.Unlock()
+		return
+	}
+	if remove {
+		delete(s.jobs, job.ID)
+	} else {
+		s.jobs[job.ID] = job
+	}
+	s.mu.Unlock()
+
+	if remove {
+		err = s.Store.Delete(ctx, job.ID)
+		if errors.Is(err, ErrJobNotFound) {
+			err = nil
+		}
+	} else {
+		err = s.Store.Save(ctx, job)
+	}
+	if err != nil && s.bot.Debug {
+		log.Printf("store scheduled job %s: %s\n", job.ID, err)
+	}
+}
+
+// advance moves a recurring job to its next run and reports whether it has one.
+func (s *Scheduler) advance(job *Job) bool {
+	if job.Cron == "" {
+		return false
+	}
+	schedule, err := parseCron(job.Cron)
+	if err != nil {
+		return false
+	}
+	job.RunAt = schedule.next(time.Now().In(s.location()))
+	return !job.RunAt.IsZero()
+}
+
+func (s *Scheduler) maxAttempts() int {
+	if s.MaxAttempts <= 0 {
+		return 1
+	}
+	return s.MaxAttempts
+}
+
+func (s *Scheduler) retryDelay() time.Duration {
+	if s.RetryDelay <= 0 {
+		return DefaultRetryDelay
+	}
+	return s.RetryDelay
+}
+
+// backoff is the wait before retrying a job that failed attempts times, doubling
+// from RetryDelay up to MaxRetryDelay. A longer RetryDelay is never doubled.
+func (s *Scheduler) backoff(attempts int) time.Duration {
+	delay := s.retryDelay()
+	if delay >= MaxRetryDelay {
+		return delay
+	}
+	for i := 1; i < attempts && delay < MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, MaxRetryDelay)
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// MemoryJobStore is a JobStore that keeps jobs in memory. Jobs do not survive a
+// restart; use FileJobStore or another persistent store for that.
+type MemoryJobStore struct {
+	mu   sync.RWMutex
+	jobs map[string]Job
+}
+
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{
+		jobs: make(map[string]Job),
+	}
+}
+
+func (s *MemoryJobStore) Save(_ context.Context, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *MemoryJobStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[id]; !ok {
+		return ErrJobNotFound
+	}
+	delete(s.jobs, id)
+	return nil
+}
+
+func (s *MemoryJobStore) List(_ context.Context) ([]Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// FileJobStore is a JobStore that keeps jobs in a JSON file, rewritten on every change.
+type FileJobStore struct {
+	Path   string
+	mem    *MemoryJobStore
+	loadMu sync.Mutex
+	loaded bool
+}
+
+func NewFileJobStore(path string) *FileJobStore {
+	return &FileJobStore{
+		Path: path,
+		mem:  NewMemoryJobStore(),
+	}
+}
+
+// load reads the jobs of Path on first use. It is retried on the next call when
+// the file cannot be read.
+func (s *FileJobStore) load() error {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+	if s.loaded {
+		return nil
+	}
+	data, err := os.ReadFile(s.Path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		var jobs []Job
+		if err := json.Unmarshal(data, &jobs); err != nil {
+			return err
+		}
+		s.mem.mu.Lock()
+		for _, job := range jobs {
+			s.mem.jobs[job.ID] = job
+		}
+		s.mem.mu.Unlock()
+	}
+	s.loaded = true
+	return nil
+}
+
+// flush writes the jobs to a temporary file and renames it over Path, so a crash
+// never leaves a half written file behind. The caller holds s.mem.mu.
+func (s *FileJobStore) flush() error {
+	jobs := make([]Job, 0, len(s.mem.jobs))
+	for _, job := range s.mem.jobs {
+		jobs = append(jobs, job)
+	}
+	data, err := json.Marshal(jobs)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+func (s *FileJobStore) Save(_ context.Context, job Job) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	s.mem.jobs[job.ID] = job
+	return s.flush()
+}
+
+func (s *FileJobStore) Delete(_ context.Context, id string) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	if _, ok := s.mem.jobs[id]; !ok {
+		return ErrJobNotFound
+	}
+	delete(s.mem.jobs, id)
+	return s.flush()
+}
+
+func (s *FileJobStore) List(ctx context.Context) ([]Job, error) {
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s.mem.List(ctx)
+}
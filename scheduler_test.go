@@ -0,0 +1,208 @@
+package gapBotApi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileJobStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	store := NewFileJobStore(path)
+	if jobs, err := store.List(ctx); err != nil || len(jobs) != 0 {
+		t.Fatalf("List() of a missing file = %v, %v", jobs, err)
+	}
+	runAt := time.Date(2026, 3, 21, 9, 0, 0, 0, time.UTC)
+	for _, job := range []Job{
+		{ID: "a", ChatID: 1, Method: "sendMessage", Params: Params{"data": "hi"}, RunAt: runAt},
+		{ID: "b", ChatID: 2, Method: "sendMessage", RunAt: runAt, Cron: "@daily"},
+	} {
+		if err := store.Save(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Delete(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "b"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Delete() of a deleted job = %v, want ErrJobNotFound", err)
+	}
+
+	jobs, err := NewFileJobStore(path).List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != "a" || jobs[0].Params["data"] != "hi" || !jobs[0].RunAt.Equal(runAt) {
+		t.Errorf("reloaded jobs = %+v, want job a", jobs)
+	}
+	if leftovers, _ := filepath.Glob(path + ".*"); len(leftovers) != 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := NewFileJobStore(path)
+	if _, err := corrupt.List(ctx); err == nil {
+		t.Error("List() of a corrupt file succeeded")
+	}
+	// the load is retried once the file is repaired
+	if err := os.WriteFile(path, []byte(`[{"id":"c","chat_id":3}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := corrupt.List(ctx); err != nil || len(jobs) != 1 || jobs[0].ID != "c" {
+		t.Errorf("List() after the file was repaired = %+v, %v, want job c", jobs, err)
+	}
+}
+
+func TestSchedulerLoadsStoreBeforeStart(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryJobStore()
+	for _, job := range []Job{
+		{ID: "a", ChatID: 1, RunAt: time.Now().Add(time.Hour)},
+		{ID: "b", ChatID: 2, RunAt: time.Now().Add(2 * time.Hour)},
+	} {
+		if err := store.Save(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewScheduler(&BotAPI{}, store)
+	if jobs := s.List(1); len(jobs) != 1 || jobs[0].ID != "a" {
+		t.Errorf("List(1) = %+v, want job a", jobs)
+	}
+	if err := s.Cancel("b"); err != nil {
+		t.Fatalf("Cancel() of a stored job = %v", err)
+	}
+	if stored, _ := store.List(ctx); len(stored) != 1 {
+		t.Errorf("%d jobs left in the store, want 1", len(stored))
+	}
+}
+
+func TestSchedulerRetryBackoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryDelay time.Duration
+		want       time.Duration
+	}{
+		{name: "set", retryDelay: time.Second, want: time.Second},
+		{name: "zero", want: DefaultRetryDelay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMemoryJobStore()
+			s := NewScheduler(&BotAPI{}, store)
+			s.RetryDelay = tt.retryDelay
+			var givenUp []Job
+			s.OnError = func(job Job, err error) {
+				givenUp = append(givenUp, job)
+			}
+			job := Job{ID: "a", RunAt: time.Now()}
+			s.jobs[job.ID] = job
+			failure := errors.New("unavailable")
+			for attempt := 1; attempt < s.MaxAttempts; attempt++ {
+				start := time.Now()
+				s.finish(ctx, job, failure)
+				job = s.jobs["a"]
+				delay := job.RunAt.Sub(start)
+				want := tt.want << (attempt - 1)
+				if job.Attempts != attempt || delay < want || delay > want+time.Second {
+					t.Errorf("attempt %d retries in %s with %d attempts, want %s", attempt, delay, job.Attempts, want)
+				}
+				if job.LastError != "unavailable" {
+					t.Errorf("LastError = %q", job.LastError)
+				}
+			}
+			s.finish(ctx, job, failure)
+			if len(givenUp) != 1 || givenUp[0].Attempts != s.MaxAttempts {
+				t.Errorf("OnError got %+v, want the job after %d attempts", givenUp, s.MaxAttempts)
+			}
+			if len(s.List(0)) != 0 {
+				t.Error("a one-off job given up on is still pending")
+			}
+		})
+	}
+}
+
+func TestSchedulerBackoffCap(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryDelay time.Duration
+		attempts   int
+		want       time.Duration
+	}{
+		{name: "first retry", retryDelay: time.Second, attempts: 1, want: time.Second},
+		{name: "doubled", retryDelay: time.Second, attempts: 4, want: 8 * time.Second},
+		{name: "capped", retryDelay: time.Hour, attempts: 6, want: MaxRetryDelay},
+		{name: "past the shift width", retryDelay: time.Second, attempts: 200, want: MaxRetryDelay},
+		{name: "long retry delay", retryDelay: 48 * time.Hour, attempts: 3, want: 48 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScheduler(&BotAPI{}, NewMemoryJobStore())
+			s.RetryDelay = tt.retryDelay
+			if got := s.backoff(tt.attempts); got != tt.want {
+				t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedulerDeliversAfterRetry(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	delivered := make(chan string, 1)
+	bot := newTestBot(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			fmt.Fprint(w, `{"error":"unavailable"}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":1}`)
+		delivered <- r.FormValue("data")
+	})
+	store := NewMemoryJobStore()
+	// the job came due while the bot was down
+	err := store.Save(context.Background(), Job{ID: "a", ChatID: 1, Method: "sendMessage", Params: Params{"chat_id": "1", "type": "text", "data": "hi"}, RunAt: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewScheduler(bot, store)
+	s.RetryDelay = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(ctx); !errors.Is(err, ErrSchedulerRunning) {
+		t.Errorf("second Start() = %v, want ErrSchedulerRunning", err)
+	}
+
+	select {
+	case data := <-delivered:
+		if data != "hi" {
+			t.Errorf("delivered %q, want hi", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job was not delivered")
+	}
+	// the job is removed from the store right after its delivery
+	deadline := time.Now().Add(5 * time.Second)
+	stored, _ := store.List(context.Background())
+	for len(stored) != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		stored, _ = store.List(context.Background())
+	}
+	if len(stored) != 0 || len(s.List(0)) != 0 {
+		t.Errorf("delivered job still pending: %+v", stored)
+	}
+}
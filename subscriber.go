@@ -0,0 +1,201 @@
+package gapBotApi
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrSubscriberNotFound = errors.New("subscriber not found")
+
+// Subscriber is a chat that has talked to the bot.
+type Subscriber struct {
+	ChatID     int64
+	User       User
+	FirstSeen  time.Time
+	LastActive time.Time
+	// LeftAt is when the chat last left the bot, zero while it is subscribed.
+	LeftAt time.Time
+}
+
+// Active reports whether the chat is still subscribed.
+func (s Subscriber) Active() bool {
+	return s.LeftAt.IsZero()
+}
+
+// SubscriberQuery selects subscribers. The zero value selects every active subscriber.
+type SubscriberQuery struct {
+	// IncludeLeft also selects the chats that left the bot.
+	IncludeLeft bool
+	// ActiveSince selects the chats active at or after it when set.
+	ActiveSince time.Time
+	// SeenSince selects the chats first seen at or after it when set.
+	SeenSince time.Time
+}
+
+func (q SubscriberQuery) matches(s Subscriber) bool {
+	if !q.IncludeLeft && !s.Active() {
+		return false
+	}
+	if !q.ActiveSince.IsZero() && s.LastActive.Before(q.ActiveSince) {
+		return false
+	}
+	if !q.SeenSince.IsZero() && s.FirstSeen.Before(q.SeenSince) {
+		return false
+	}
+	return true
+}
+
+// SubscriberStore persists subscribers.
+type SubscriberStore interface {
+	// Get returns the subscriber of a chat or ErrSubscriberNotFound.
+	Get(ctx context.Context, chatID int64) (Subscriber, error)
+	// Save adds a subscriber or replaces the one of the same chat.
+	Save(ctx context.Context, subscriber Subscriber) error
+	// Query returns the matching subscribers, first seen first.
+	Query(ctx context.Context, q SubscriberQuery) ([]Subscriber, error)
+	// Count returns the number of matching subscribers.
+	Count(ctx context.Context, q SubscriberQuery) (int, error)
+}
+
+// Subscribers keeps track of the chats that join, leave and message the bot.
+// Set it as BotAPI.Subscribers to record every update before it is routed.
+type Subscribers struct {
+	Store SubscriberStore
+	mu    sync.Mutex
+}
+
+func NewSubscribers(store SubscriberStore) *Subscribers {
+	return &Subscribers{
+		Store: store,
+	}
+}
+
+// Track records the chat of an update. A join or a message marks the chat as
+// subscribed and a leave marks it as left. Button presses, form submissions and
+// payment callbacks only count as activity: they can come from a message sent
+// before the chat left, so they do not subscribe it again.
+func (r *Subscribers) Track(ctx context.Context, message *Message) error {
+	if message.ChatID == 0 {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	subscriber, err := r.Store.Get(ctx, message.ChatID)
+	if errors.Is(err, ErrSubscriberNotFound) {
+		subscriber = Subscriber{ChatID: message.ChatID, FirstSeen: now}
+	} else if err != nil {
+		return err
+	}
+	if message.From.Id != 0 {
+		subscriber.User = message.From
+	}
+	subscriber.LastActive = now
+	switch message.Type {
+	case MESSAGE_TYPE_LEAVE:
+		subscriber.LeftAt = now
+	case MESSAGE_TYPE_TRIGGER_BUTTON, MESSAGE_TYPE_SUBMITFORM, MESSAGE_TYPE_PAY_CALLBACK, MESSAGE_TYPE_INVOICE_CALLBACK:
+		// activity only, LeftAt is kept
+	default:
+		subscriber.LeftAt = time.Time{}
+	}
+	return r.Store.Save(ctx, subscriber)
+}
+
+// Get returns the subscriber of a chat or ErrSubscriberNotFound.
+func (r *Subscribers) Get(ctx context.Context, chatID int64) (Subscriber, error) {
+	return r.Store.Get(ctx, chatID)
+}
+
+// Query returns the subscribers selected by q.
+func (r *Subscribers) Query(ctx context.Context, q SubscriberQuery) ([]Subscriber, error) {
+	return r.Store.Query(ctx, q)
+}
+
+// Count returns the number of subscribers selected by q.
+func (r *Subscribers) Count(ctx context.Context, q SubscriberQuery) (int, error) {
+	return r.Store.Count(ctx, q)
+}
+
+// Audience returns the subscribers selected by q as the Audience of a broadcast.
+// The subscribers are queried when the broadcast asks for its first recipient.
+func (r *Subscribers) Audience(q SubscriberQuery) Audience {
+	var subscribers []Subscriber
+	loaded := false
+	return AudienceFunc(func(ctx context.Context) (int64, bool, error) {
+		if !loaded {
+			var err error
+			subscribers, err = r.Store.Query(ctx, q)
+			if err != nil {
+				return 0, false, err
+			}
+			loaded = true
+		}
+		if len(subscribers) == 0 {
+			return 0, false, nil
+		}
+		chatID := subscribers[0].ChatID
+		subscribers = subscribers[1:]
+		return chatID, true, nil
+	})
+}
+
+// MemorySubscriberStore is a SubscriberStore that keeps subscribers in memory.
+type MemorySubscriberStore struct {
+	mu          sync.RWMutex
+	subscribers map[int64]Subscriber
+}
+
+func NewMemorySubscriberStore() *MemorySubscriberStore {
+	return &MemorySubscriberStore{
+		subscribers: make(map[int64]Subscriber),
+	}
+}
+
+func (s *MemorySubscriberStore) Get(_ context.Context, chatID int64) (Subscriber, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	subscriber, ok := s.subscribers[chatID]
+	if !ok {
+		return Subscriber{}, ErrSubscriberNotFound
+	}
+	return subscriber, nil
+}
+
+func (s *MemorySubscriberStore) Save(_ context.Context, subscriber Subscriber) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers[subscriber.ChatID] = subscriber
+	return nil
+}
+
+func (s *MemorySubscriberStore) Query(_ context.Context, q SubscriberQuery) ([]Subscriber, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var subscribers []Subscriber
+	for _, subscriber := range s.subscribers {
+		if q.matches(subscriber) {
+			subscribers = append(subscribers, subscriber)
+		}
+	}
+	sort.Slice(subscribers, func(i, j int) bool {
+		return subscribers[i].FirstSeen.Before(subscribers[j].FirstSeen)
+	})
+	return subscribers, nil
+}
+
+func (s *MemorySubscriberStore) Count(_ context.Context, q SubscriberQuery) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	count := 0
+	for _, subscriber := range s.subscribers {
+		if q.matches(subscriber) {
+			count++
+		}
+	}
+	return count, nil
+}
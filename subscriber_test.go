@@ -0,0 +1,114 @@
+package gapBotApi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSubscribersTrack(t *testing.T) {
+	tests := []struct {
+		name   string
+		typ    MESSAGE_TYPE
+		active bool
+	}{
+		{name: "join", typ: MESSAGE_TYPE_JOIN, active: true},
+		{name: "message", typ: MESSAGE_TYPE_TEXT, active: true},
+		{name: "photo", typ: MESSAGE_TYPE_IMAGE, active: true},
+		{name: "stale button", typ: MESSAGE_TYPE_TRIGGER_BUTTON},
+		{name: "stale form", typ: MESSAGE_TYPE_SUBMITFORM},
+		{name: "stale pay callback", typ: MESSAGE_TYPE_PAY_CALLBACK},
+		{name: "stale invoice callback", typ: MESSAGE_TYPE_INVOICE_CALLBACK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			subscribers := NewSubscribers(NewMemorySubscriberStore())
+			for _, typ := range []MESSAGE_TYPE{MESSAGE_TYPE_JOIN, MESSAGE_TYPE_LEAVE} {
+				if err := subscribers.Track(ctx, &Message{ChatID: 1, Type: typ, From: User{Id: 42}}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			left, err := subscribers.Get(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if left.Active() {
+				t.Fatal("chat is still subscribed after leaving")
+			}
+
+			if err := subscribers.Track(ctx, &Message{ChatID: 1, Type: tt.typ}); err != nil {
+				t.Fatal(err)
+			}
+			subscriber, err := subscribers.Get(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if subscriber.Active() != tt.active {
+				t.Errorf("Active() = %v after a %s, want %v", subscriber.Active(), tt.typ, tt.active)
+			}
+			if subscriber.LastActive.Before(left.LastActive) || !subscriber.FirstSeen.Equal(left.FirstSeen) || subscriber.User.Id != 42 {
+				t.Errorf("subscriber %+v after %+v", subscriber, left)
+			}
+		})
+	}
+}
+
+func TestSubscribersQuery(t *testing.T) {
+	ctx := context.Background()
+	subscribers := NewSubscribers(NewMemorySubscriberStore())
+	for _, message := range []Message{
+		{ChatID: 1, Type: MESSAGE_TYPE_JOIN},
+		{ChatID: 2, Type: MESSAGE_TYPE_TEXT},
+		{ChatID: 3, Type: MESSAGE_TYPE_JOIN},
+		{ChatID: 3, Type: MESSAGE_TYPE_LEAVE},
+		{Type: MESSAGE_TYPE_TEXT},
+	} {
+		if err := subscribers.Track(ctx, &message); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := subscribers.Get(ctx, 0); !errors.Is(err, ErrSubscriberNotFound) {
+		t.Errorf("Get() of an update without chat = %v, want ErrSubscriberNotFound", err)
+	}
+
+	tests := []struct {
+		name string
+		q    SubscriberQuery
+		want []int64
+	}{
+		{name: "active", want: []int64{1, 2}},
+		{name: "include left", q: SubscriberQuery{IncludeLeft: true}, want: []int64{1, 2, 3}},
+		{name: "seen since", q: SubscriberQuery{SeenSince: time.Now().Add(time.Hour)}},
+		{name: "active since", q: SubscriberQuery{IncludeLeft: true, ActiveSince: time.Now().Add(-time.Hour)}, want: []int64{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int64
+			audience := subscribers.Audience(tt.q)
+			for {
+				chatID, ok, err := audience.Next(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !ok {
+					break
+				}
+				got = append(got, chatID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Audience() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Audience() = %v, want %v", got, tt.want)
+				}
+			}
+			if count, _ := subscribers.Count(ctx, tt.q); count != len(tt.want) {
+				t.Errorf("Count() = %d, want %d", count, len(tt.want))
+			}
+		})
+	}
+}
@@ -1,5 +1,11 @@
 package gapBotApi
 
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
 type (
 	CallbackQuery struct {
 		MessageID  int64               `json:"message_id"`
@@ -40,6 +46,7 @@ type (
 		Options []FormObjectOption `json:"options,omitempty"`
 	}
 	FormObjectOption map[string]string
+	Form             []FormObject
 
 	Location struct {
 		Lat  string `json:"lat"`
@@ -48,15 +55,41 @@ type (
 	}
 
 	PaymentInfo struct {
-		RefId     string `json:"ref_id"`
-		MessageId string `json:"message_id"`
-		Status    string `json:"status"`
+		RefId     string         `json:"ref_id"`
+		MessageId string         `json:"message_id"`
+		Status    PAYMENT_STATUS `json:"status"`
+	}
+
+	InvoiceInfo struct {
+		InvoiceId string         `json:"invoice_id"`
+		RefId     string         `json:"ref_id"`
+		MessageId string         `json:"message_id"`
+		Status    PAYMENT_STATUS `json:"status"`
+	}
+
+	// PaymentResult is the answer of Gap to payment and invoice verify or inquiry calls.
+	PaymentResult struct {
+		RefId     string         `json:"ref_id,omitempty"`
+		InvoiceId string         `json:"invoice_id,omitempty"`
+		Status    PAYMENT_STATUS `json:"status"`
+		Amount    int            `json:"amount,omitempty"`
+		TraceId   string         `json:"trace_id,omitempty"`
 	}
 
 	APIResponse struct {
 		Error     string `json:"error"`
 		TraceId   string `json:"trace_id"`
 		MessageId int64  `json:"id"`
+		// Raw is the unparsed response body.
+		Raw []byte `json:"-"`
+	}
+
+	// SendResult is the outcome of BotAPI.SendWithResult.
+	SendResult struct {
+		// Message is the sent message as far as it is known from the request.
+		Message  Message
+		Response *APIResponse
+		TraceId  string
 	}
 
 	File struct {
@@ -83,6 +116,8 @@ type (
 		CallbackID string            `json:"callback_id"`
 		RowData    string            `json:"data"`
 		Data       map[string]string `json:"-"`
+		// Values holds every submitted value, e.g. all choices of a multi-select.
+		Values url.Values `json:"-"`
 	}
 	UploadResponse struct {
 		APIResponse `json:"-"`
@@ -92,6 +127,8 @@ type (
 	// Error is an error containing extra information returned by the Telegram API.
 	Error struct {
 		Message string
+		// StatusCode is the HTTP status of the response, zero when it is unknown.
+		StatusCode int
 	}
 
 	// Message represents a messageHandler.
@@ -107,15 +144,34 @@ type (
 		Voice         File          `json:"voice,omitempty"`
 		Audio         File          `json:"audio,omitempty"`
 		File          File          `json:"file,omitempty"`
+		Sticker       File          `json:"sticker,omitempty"`
 		PaymentInfo   PaymentInfo   `json:"payment_info,omitempty"`
+		InvoiceInfo   InvoiceInfo   `json:"invoice_info,omitempty"`
 		CallbackQuery CallbackQuery `json:"callback,omitempty"`
 		Contact       Contact       `json:"contact,omitempty"`
 		Location      Location      `json:"location,omitempty"`
 		FormData      FormData      `json:"form_data,omitempty"`
+		// RawUpdate is the update exactly as Gap sent it.
+		RawUpdate json.RawMessage `json:"-"`
+	}
+	// ReplyKeyboardButton is encoded the way Gap expects, as {value: text} for text
+	// buttons and {"$location": text} or {"$contact": text} for the others.
+	ReplyKeyboardButton struct {
+		Text string
+		// Value is what the bot receives when the button is pressed. It defaults to Text.
+		Value string
+		Type  REPLY_KEYBOARD_BUTTON_TYPE
 	}
-	ReplyKeyboardButton map[string]string
 	ReplyKeyboardMarkup struct {
 		Keyboard [][]ReplyKeyboardButton `json:"keyboard"`
+		// OneTime hides the keyboard once a button was pressed.
+		OneTime bool `json:"once,omitempty"`
+		// Resize fits the keyboard height to its buttons.
+		Resize bool `json:"resize,omitempty"`
+	}
+	// ReplyKeyboardRemove removes the reply keyboard shown to the user.
+	ReplyKeyboardRemove struct {
+		Remove bool `json:"remove"`
 	}
 
 	InlineKeyboardButton struct {
@@ -130,8 +186,103 @@ type (
 	}
 
 	InlineKeyboardMarkup [][]InlineKeyboardButton
+
+	// MediaRule describes what an upload of a given message type may look like.
+	MediaRule struct {
+		// Extensions lists the allowed lowercase file extensions, dot included. Empty allows any.
+		Extensions []string
+		// MimeTypes lists the allowed MIME type prefixes as sniffed from the content. Empty allows any.
+		MimeTypes []string
+		// MaxSize is the size ceiling in bytes. Zero disables the check.
+		MaxSize int64
+	}
+
+	// ImageOptions controls how photos are processed before upload. JPEG and PNG
+	// photos are decoded and re-encoded in pure Go, which also drops EXIF data.
+	// GIF and WebP photos are always sent unchanged.
+	ImageOptions struct {
+		// MaxDimension is the longest side in pixels. Zero keeps the original size.
+		MaxDimension int
+		// JPEGQuality is the re-encoding quality between 1 and 100. Zero keeps the
+		// original JPEG unless it has to be re-encoded anyway, and then uses 85.
+		JPEGQuality int
+		// StripMetadata re-encodes JPEG and PNG photos even when nothing else
+		// requires it, so their EXIF and other metadata never leave the bot. GIF and
+		// WebP photos keep their metadata: the standard library cannot encode WebP,
+		// and re-encoding a GIF would drop its animation.
+		StripMetadata bool
+		// MaxPixels is the largest width times height decoded. Larger photos are
+		// rejected before decoding. Zero means DefaultMaxImagePixels.
+		MaxPixels int
+	}
+
+	// UnknownUpdateError is returned for updates of a type this package does not
+	// parse when BotAPI.StrictUpdates is set.
+	UnknownUpdateError struct {
+		Type MESSAGE_TYPE
+	}
+
+	// MediaError is returned when a file fails the checks of its MediaRule before upload.
+	MediaError struct {
+		Type     MESSAGE_TYPE
+		Name     string
+		Reason   MEDIA_ERROR_REASON
+		Size     int64
+		MaxSize  int64
+		MimeType string
+	}
 )
 
 func (e Error) Error() string {
 	return e.Message
 }
+
+func (button ReplyKeyboardButton) MarshalJSON() ([]byte, error) {
+	key := button.Value
+	switch button.Type {
+	case REPLY_KEYBOARD_BUTTON_TYPE_LOCATION, REPLY_KEYBOARD_BUTTON_TYPE_CONTACT:
+		key = string(button.Type)
+	default:
+		if key == "" {
+			key = button.Text
+		}
+	}
+	return json.Marshal(map[string]string{key: button.Text})
+}
+
+func (button *ReplyKeyboardButton) UnmarshalJSON(data []byte) error {
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for key, text := range raw {
+		button.Text = text
+		switch REPLY_KEYBOARD_BUTTON_TYPE(key) {
+		case REPLY_KEYBOARD_BUTTON_TYPE_LOCATION, REPLY_KEYBOARD_BUTTON_TYPE_CONTACT:
+			button.Type, button.Value = REPLY_KEYBOARD_BUTTON_TYPE(key), ""
+		default:
+			button.Type, button.Value = REPLY_KEYBOARD_BUTTON_TYPE_TEXT, key
+		}
+	}
+	return nil
+}
+
+func (e *UnknownUpdateError) Error() string {
+	return fmt.Sprintf("unknown update type %q", e.Type)
+}
+
+func (e *MediaError) Error() string {
+	switch e.Reason {
+	case MEDIA_ERROR_REASON_EMPTY:
+		return fmt.Sprintf("%s %q is empty", e.Type, e.Name)
+	case MEDIA_ERROR_REASON_TOO_LARGE:
+		return fmt.Sprintf("%s %q exceeds the %d bytes limit", e.Type, e.Name, e.MaxSize)
+	case MEDIA_ERROR_REASON_EXTENSION:
+		return fmt.Sprintf("%s %q has an unsupported extension", e.Type, e.Name)
+	case MEDIA_ERROR_REASON_MIME:
+		return fmt.Sprintf("%s %q has unsupported content type %s", e.Type, e.Name, e.MimeType)
+	case MEDIA_ERROR_REASON_DIMENSIONS:
+		return fmt.Sprintf("%s %q has too many pixels to process", e.Type, e.Name)
+	}
+	return fmt.Sprintf("%s %q is invalid", e.Type, e.Name)
+}